@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/engine-api/types"
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// goldenInfo is the daemon info for the golden fixtures, the default seccomp
+// profile depends on the build tags so it is left out.
+const goldenInfo = `{"SecurityOptions": ["name=apparmor"]}`
+
+// TestGolden converts the inspect.json of each fixture in testdata/golden and
+// compares the config.json and runtime.json it generates with the ones in the
+// fixture. Run it with -update to regenerate them after a mapping change.
+func TestGolden(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	// generating changes the working directory, so find the fixtures first
+	dirs, err := filepath.Glob(filepath.Join(wd, "testdata", "golden", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dirs) == 0 {
+		t.Fatal("expected golden fixtures in testdata/golden")
+	}
+
+	hooks = specs.Hooks{Prestart: []specs.Hook{{Path: "/usr/local/bin/netns"}}}
+	bundlePerm = 0755
+	defer func() { hooks, bundle, bundlePerm, runtimeHooksOnly = specs.Hooks{}, "", 0, false }()
+
+	for _, fixture := range dirs {
+		generated, c := generateGolden(t, fixture)
+		defer os.RemoveAll(generated)
+
+		for _, name := range []string{specConfig, runtimeConfig} {
+			data, err := ioutil.ReadFile(filepath.Join(generated, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if name == specConfig {
+				data = normalizeGolden(t, data, c.HostConfig.Privileged)
+			}
+
+			golden := filepath.Join(fixture, name)
+			if *update {
+				if err := ioutil.WriteFile(golden, data, 0644); err != nil {
+					t.Fatal(err)
+				}
+				continue
+			}
+			expected, err := ioutil.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(expected, data) {
+				t.Fatalf("%s of %s does not match the golden file, run the tests with -update if the change is expected, got:\n%s", name, filepath.Base(fixture), data)
+			}
+		}
+	}
+}
+
+// generateGolden writes the config.json and runtime.json for the inspect.json
+// of the fixture to a temporary bundle and returns it with the container.
+func generateGolden(t *testing.T, fixture string) (string, types.ContainerJSON) {
+	raw, err := ioutil.ReadFile(filepath.Join(fixture, "inspect.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c types.ContainerJSON
+	if err := json.Unmarshal(raw, &c); err != nil {
+		t.Fatalf("decoding the inspect.json of %s failed: %v", filepath.Base(fixture), err)
+	}
+	cli := &fakeClient{
+		containers: map[string]types.ContainerJSON{c.ID: c},
+		raw:        map[string][]byte{c.ID: raw},
+		info:       []byte(goldenInfo),
+	}
+
+	bundle, err = ioutil.TempDir("", "riddler-golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, hooksOnly := range []bool{false, true} {
+		runtimeHooksOnly = hooksOnly
+		if err := generate(cli, c.ID); err != nil {
+			t.Fatalf("generating %s failed: %v", filepath.Base(fixture), err)
+		}
+	}
+	return bundle, c
+}
+
+// normalizeGolden leaves out the parts of a config.json that depend on the
+// machine running the tests, the platform and the host devices privileged
+// containers get.
+func normalizeGolden(t *testing.T, data []byte, privileged bool) []byte {
+	var spec specs.Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+	spec.Platform = specs.Platform{OS: "linux", Arch: "amd64"}
+	if privileged {
+		spec.Linux.Devices = []specs.Device{}
+		if spec.Linux.Resources != nil {
+			spec.Linux.Resources.Devices = nil
+		}
+	}
+
+	data, err := json.MarshalIndent(spec, "", "    ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -1,20 +1,29 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 
 	"golang.org/x/net/context"
 
 	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/daemon/execdriver"
 	native "github.com/docker/docker/daemon/execdriver/native/template"
 	"github.com/docker/engine-api/client"
+	"github.com/docker/engine-api/client/transport"
+	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/filters"
 	"github.com/jessfraz/riddler/parse"
 	specs "github.com/opencontainers/specs/specs-go"
 )
@@ -33,23 +42,134 @@ const (
 	// VERSION is the binary version.
 	VERSION = "v0.1.0"
 
-	specConfig = "config.json"
+	specConfig    = "config.json"
+	runtimeConfig = "runtime.json"
+	hostsFile     = "hosts"
+	capsAuditFile = "capabilities-audit.json"
 )
 
 var (
 	arg        string
 	bundle     string
+	outputDir  string
 	dockerHost string
 	hooks      specs.Hooks
 	hookflags  stringSlice
 	force      bool
 	idroot     uint32
 	idlen      uint32
+	idrootVar  int
+	idlenVar   int
+
+	envExpand     bool
+	envExpandHost bool
+	sortKeys      bool
+	runningOnly   bool
+	labelFilters  stringSlice
+
+	failOnHostNamespace bool
+	allowedHostNs       stringSlice
+
+	capsIntersectKernel bool
+	kernelCaps          stringSlice
+	ambientCaps         stringSlice
+	noCaps              bool
+	syscalls            stringSlice
+	syscallsFile        string
+	capsComment         bool
+	capsImageLabel      string
+	capsWarnPrivileged  bool
+	selinuxLabel        string
+	omitRootPath        bool
+	capsPolicy          string
+	capsAudit           bool
+	bundlePermissions   string
+	bundlePerm          os.FileMode
+	emitDeprecated      bool
+	stripGids           bool
+	capNameStyle        string
+	genHosts            bool
+	userFromImage       bool
+	idmapMounts         bool
+	emitAnnotationsOnly bool
+	emitResourcesOnly   bool
+	emitNamespacesOnly  bool
+	emitProcessOnly     bool
+	emitHooksOnly       bool
+	emitRootOnly        bool
+	emitLinuxOnly       bool
+	runtimeHooksOnly    bool
+	versionInFilename   bool
+	specVersion         string
+	strictVersion       bool
+	validateUser        bool
+	defaultMountsOrder  string
+	strictMounts        bool
+	validateRlimits     bool
+	validateMountTypes  bool
+	personality         string
+	cgroupDriver        string
+	execFile            string
+	execConfig          *parse.ExecConfig
+
+	dryRun bool
 
 	debug   bool
 	version bool
+
+	// stderr is where the dry run summary goes.
+	stderr io.Writer = os.Stderr
+	// stdout is where the sections of the emit modes go.
+	stdout io.Writer = os.Stdout
 )
 
+// dockerClient is the part of the docker API riddler uses.
+type dockerClient interface {
+	ContainerInspectWithRaw(ctx context.Context, containerID string, getSize bool) (types.ContainerJSON, []byte, error)
+	ImageInspectWithRaw(ctx context.Context, imageID string, getSize bool) (types.ImageInspect, []byte, error)
+	InfoRaw(ctx context.Context) ([]byte, error)
+	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
+}
+
+// apiClient is the engine-api client with the calls it does not have.
+type apiClient struct {
+	*client.Client
+	host    string
+	headers map[string]string
+}
+
+// InfoRaw returns the raw daemon info JSON, the vendored types.Info does not
+// have the fields of newer daemons.
+func (c apiClient) InfoRaw(ctx context.Context) ([]byte, error) {
+	proto, addr, basePath, err := client.ParseHost(c.host)
+	if err != nil {
+		return nil, err
+	}
+	tr, err := transport.NewTransportWithHTTP(proto, addr, nil)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", basePath+"/info", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.Host = addr
+	req.URL.Scheme = tr.Scheme()
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := tr.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("daemon info returned %s", resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
 // stringSlice is a slice of strings
 type stringSlice []string
 
@@ -93,15 +213,97 @@ func (s stringSlice) ParseHooks() (hooks specs.Hooks, err error) {
 }
 
 func init() {
-	var idrootVar, idlenVar int
-	// parse flags
+	// register flags
 	flag.StringVar(&dockerHost, "host", "unix:///var/run/docker.sock", "Docker Daemon socket(s) to connect to")
 	flag.StringVar(&bundle, "bundle", "", "Path to the root of the bundle directory")
+	flag.StringVar(&outputDir, "output-dir", "", "Path to write the config files to, if not the bundle directory")
+	flag.StringVar(&bundlePermissions, "bundle-permissions", "0755", "Permissions for the bundle directory, if it has to be created")
 	flag.Var(&hookflags, "hook", "Hooks to prefill into spec file. (ex. --hook prestart:netns)")
 
 	flag.IntVar(&idrootVar, "idroot", 0, "Root UID/GID for user namespaces")
 	flag.IntVar(&idlenVar, "idlen", 0, "Length of UID/GID ID space ranges for user namespaces")
 
+	flag.BoolVar(&envExpand, "process-env-expand", false, "expand ${VAR} references in env values against the other env vars")
+	flag.BoolVar(&envExpandHost, "process-env-expand-host", false, "fall back to the host env when expanding env values")
+
+	flag.BoolVar(&sortKeys, "spec-pretty-sort-keys", false, "sort all object keys in the generated JSON")
+
+	flag.Var(&labelFilters, "container-label-filter", "Generate a bundle for each container with the label instead of the one named, in a directory per container (ex. --container-label-filter app=web)")
+
+	flag.BoolVar(&runningOnly, "from-running-only", false, "refuse to generate a spec from a container that is not running")
+
+	flag.BoolVar(&failOnHostNamespace, "fail-on-host-namespace", false, "refuse to generate a spec from a container sharing a namespace with the host")
+	flag.Var(&allowedHostNs, "allow-host-namespace", "Host namespace the container may share with --fail-on-host-namespace (ex. --allow-host-namespace network)")
+
+	flag.BoolVar(&capsIntersectKernel, "capabilities-intersect-kernel", false, "drop capabilities the kernel does not support")
+	flag.Var(&kernelCaps, "kernel-cap", "Capability supported by the target kernel, defaults to the ones of the running kernel (ex. --kernel-cap CHOWN)")
+
+	flag.BoolVar(&omitRootPath, "omit-root-path", false, "leave root.path empty for bundles with an externally managed rootfs")
+
+	flag.Var(&ambientCaps, "cap-ambient", "Ambient capability for the process, it must also be one of its capabilities (ex. --cap-ambient NET_BIND_SERVICE)")
+
+	flag.BoolVar(&noCaps, "process-no-capabilities", false, "leave the process without any capabilities, for maximally unprivileged bundles")
+
+	flag.Var(&syscalls, "capabilities-from-syscall", "Syscall the process needs, adds the capability it usually requires (ex. --capabilities-from-syscall mount)")
+	flag.StringVar(&syscallsFile, "capabilities-from-syscalls-file", "", "Path to a file listing the syscalls the process needs, one per line")
+
+	flag.StringVar(&capsImageLabel, "capabilities-from-image-label", "", "Image label with a comma separated list of capabilities the process needs (ex. --capabilities-from-image-label org.example.capabilities)")
+
+	flag.BoolVar(&capsComment, "emit-capabilities-comment", false, "record how the capabilities were derived from the template, adds, drops and the later steps as an annotation")
+
+	flag.BoolVar(&capsWarnPrivileged, "capabilities-warn-on-privileged-only", false, "only warn about each dangerous capability if the container is not privileged")
+
+	flag.StringVar(&capsPolicy, "capabilities-policy", "", "Path to a JSON capability policy file listing the allowed capabilities")
+
+	flag.BoolVar(&capsAudit, "capabilities-audit-json", false, "write a "+capsAuditFile+" with whether each capability is in the base set, added, dropped and kept, for security audits")
+
+	flag.StringVar(&selinuxLabel, "process-selinux-label", "", "SELinux label for the process, overrides the label from the security opts")
+
+	flag.BoolVar(&emitDeprecated, "emit-deprecated-fields", true, "emit fields later spec versions moved where older runc versions read them, instead of where the later versions have them")
+
+	flag.BoolVar(&stripGids, "strip-supplementary-gids", false, "leave the process without supplementary groups")
+
+	flag.StringVar(&capNameStyle, "capability-name-style", parse.CapabilityStylePrefixed, "How to name capabilities, 'prefixed' (CAP_CHOWN) or 'short' (CHOWN)")
+
+	flag.BoolVar(&genHosts, "hosts-file", false, "generate a hosts file with the network aliases into the bundle and mount it at /etc/hosts")
+
+	flag.BoolVar(&userFromImage, "process-user-from-image", false, "use the user of the image if the container does not set one")
+
+	flag.BoolVar(&idmapMounts, "emit-idmap-mounts", false, "idmap bind mounts into the user namespace, needs spec version "+parse.MinIdmapMountsVersion)
+
+	flag.BoolVar(&validateUser, "validate-user-exists", false, "refuse a user or group name that is not in the passwd or group file of the container instead of warning about it")
+
+	flag.StringVar(&defaultMountsOrder, "default-mounts-order", parse.DefaultMountsLast, "Where to put the default mounts relative to the container mounts, 'first' or 'last'")
+
+	flag.BoolVar(&strictMounts, "strict-mounts", false, "refuse mounts of a type riddler does not know instead of converting them to bind mounts")
+
+	flag.BoolVar(&validateMountTypes, "emit-mounts-with-types-validated", false, "warn about mounts with a type other than bind, tmpfs, proc, sysfs, cgroup, devpts, mqueue or shm")
+
+	flag.BoolVar(&validateRlimits, "validate-rlimits", false, "refuse ulimits docker does not know and rlimits of an unknown type or with a soft limit above the hard limit")
+
+	flag.StringVar(&personality, "linux-personality", "", "Execution domain of the process, 'LINUX' or 'LINUX32' for 32 bit containers on 64 bit hosts, needs spec version "+parse.MinPersonalityVersion)
+
+	flag.StringVar(&cgroupDriver, "cgroup-driver", "", "How the target host manages cgroups, 'cgroupfs' or 'systemd', defaults to the cgroup driver of the daemon")
+
+	flag.StringVar(&execFile, "from-exec", "", "Path to a JSON docker exec config (User, Privileged, Tty, Env, Cmd, WorkingDir) to overlay on the process of the container")
+
+	flag.BoolVar(&emitAnnotationsOnly, "emit-annotations-only", false, "print only the annotations of the spec as JSON, without writing the bundle")
+	flag.BoolVar(&emitResourcesOnly, "emit-resources-only", false, "print only the linux resources of the spec as JSON, without writing the bundle")
+	flag.BoolVar(&emitNamespacesOnly, "emit-namespaces-only", false, "print only the linux namespaces of the spec as JSON, without writing the bundle")
+	flag.BoolVar(&emitProcessOnly, "emit-process-only", false, "print only the process of the spec as JSON, without writing the bundle")
+	flag.BoolVar(&emitHooksOnly, "emit-hooks-only", false, "print only the hooks of the spec as JSON, without writing the bundle")
+	flag.BoolVar(&emitRootOnly, "emit-root-only", false, "print only the root of the spec as JSON, without writing the bundle")
+	flag.BoolVar(&emitLinuxOnly, "emit-linux-only", false, "print only the linux section of the spec as JSON, without writing the bundle")
+
+	flag.BoolVar(&runtimeHooksOnly, "runtime-json-only-hooks", false, "write a runtime.json with only the hooks instead of config.json, to layer them onto an existing runtime spec")
+
+	flag.StringVar(&specVersion, "spec-version", parse.SpecVersion, "Version of the spec to generate, one of "+strings.Join(parse.SpecVersions, ", "))
+	flag.BoolVar(&strictVersion, "strict-version", false, "refuse a --spec-version riddler does not know instead of generating the default version")
+
+	flag.BoolVar(&versionInFilename, "emit-spec-version-in-filename", false, "put the spec version in the name of the written file (ex. config.v1.0.0-rc3.json), for bundles targeting several runc versions")
+
+	flag.BoolVar(&dryRun, "dry-run", false, "print the files that would be written and a summary of the spec to stderr, without writing anything")
+
 	flag.BoolVar(&force, "force", false, "force overwrite existing files")
 	flag.BoolVar(&force, "f", false, "force overwrite existing files")
 
@@ -113,7 +315,11 @@ func init() {
 		fmt.Fprint(os.Stderr, fmt.Sprintf(BANNER, VERSION))
 		flag.PrintDefaults()
 	}
+}
 
+// parseFlags parses the command line and validates the flags, it is kept
+// out of init so tests can use the package without a command line.
+func parseFlags() {
 	flag.Parse()
 	idroot = uint32(idrootVar)
 	idlen = uint32(idlenVar)
@@ -123,12 +329,15 @@ func init() {
 		os.Exit(0)
 	}
 
-	if flag.NArg() < 1 {
+	// the containers are picked by label in batch mode
+	if flag.NArg() < 1 && len(labelFilters) == 0 {
 		usageAndExit("Pass the container name or ID.", 1)
 	}
 
 	// parse the arg
-	arg = flag.Args()[0]
+	if flag.NArg() > 0 {
+		arg = flag.Args()[0]
+	}
 	if arg == "help" {
 		usageAndExit("", 0)
 	}
@@ -143,51 +352,477 @@ func init() {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 
-	var err error
+	perm, err := strconv.ParseUint(bundlePermissions, 8, 32)
+	if err != nil {
+		logrus.Fatalf("parsing bundle permissions %s failed: %v", bundlePermissions, err)
+	}
+	bundlePerm = os.FileMode(perm)
+
 	hooks, err = hookflags.ParseHooks()
 	if err != nil {
 		logrus.Fatal(err)
 	}
+
+	if syscallsFile != "" {
+		fromFile, err := parse.LoadSyscalls(syscallsFile)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+		syscalls = append(syscalls, fromFile...)
+	}
+
+	if noCaps && len(ambientCaps) > 0 {
+		logrus.Fatal("--cap-ambient can not be used with --process-no-capabilities, the process has no capabilities to make ambient")
+	}
+
+	specVersion, err = parse.ResolveSpecVersion(specVersion, strictVersion)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	if execFile != "" {
+		execConfig, err = parse.LoadExecConfig(execFile)
+		if err != nil {
+			logrus.Fatal(err)
+		}
+	}
+
+	n := 0
+	for _, set := range []bool{emitAnnotationsOnly, emitResourcesOnly, emitNamespacesOnly, emitProcessOnly, emitHooksOnly, emitRootOnly, emitLinuxOnly} {
+		if set {
+			n++
+		}
+	}
+	if n > 1 {
+		logrus.Fatal("Only one of the --emit-*-only flags can be set")
+	}
 }
 
 func main() {
+	parseFlags()
+
 	defaultHeaders := map[string]string{"User-Agent": "engine-api-cli-1.0"}
-	cli, err := client.NewClient(dockerHost, "", nil, defaultHeaders)
+	engine, err := client.NewClient(dockerHost, "", nil, defaultHeaders)
 	if err != nil {
 		panic(err)
 	}
+	cli := apiClient{Client: engine, host: dockerHost, headers: defaultHeaders}
+
+	if len(labelFilters) > 0 {
+		err = generateBatch(cli, labelFilters)
+	} else {
+		err = generate(cli, arg)
+	}
+	if err != nil {
+		logrus.Fatal(err)
+	}
+}
+
+// generateBatch generates a bundle for each container matching the label
+// filters, in a directory named after the container under the bundle and
+// output directories.
+func generateBatch(cli dockerClient, labels []string) error {
+	containers, err := listContainers(cli, labels)
+	if err != nil {
+		return err
+	}
+	if len(containers) == 0 {
+		return fmt.Errorf("no containers match the label filters %s", strings.Join(labels, ", "))
+	}
+
+	// writing the config changes the working directory, so make the
+	// directories absolute before the first one is written
+	bundleBase, err := filepath.Abs(bundle)
+	if err != nil {
+		return err
+	}
+	var outputBase string
+	if outputDir != "" {
+		if outputBase, err = filepath.Abs(outputDir); err != nil {
+			return err
+		}
+	}
+	defer func(b, o string) { bundle, outputDir = b, o }(bundle, outputDir)
+
+	for _, ct := range containers {
+		name := ct.ID
+		if len(ct.Names) > 0 {
+			name = strings.TrimPrefix(ct.Names[0], "/")
+		}
+		bundle = filepath.Join(bundleBase, name)
+		if outputBase != "" {
+			outputDir = filepath.Join(outputBase, name)
+		}
+		if err := generate(cli, ct.ID); err != nil {
+			return fmt.Errorf("generating the bundle for %s failed: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// listContainers returns the containers, running or not, that have all the
+// labels, each one a key or key=value.
+func listContainers(cli dockerClient, labels []string) ([]types.Container, error) {
+	args := filters.NewArgs()
+	for _, l := range labels {
+		args.Add("label", l)
+	}
+	containers, err := cli.ContainerList(context.Background(), types.ContainerListOptions{
+		All:    true,
+		Limit:  -1,
+		Filter: args,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("listing containers failed: %v", err)
+	}
+	return containers, nil
+}
 
+// generate writes the spec for the container with the given name or ID.
+func generate(cli dockerClient, id string) error {
 	// get container info
-	c, err := cli.ContainerInspect(context.Background(), arg)
+	c, raw, err := cli.ContainerInspectWithRaw(context.Background(), id, false)
+	if err != nil {
+		return fmt.Errorf("inspecting container (%s) failed: %v", id, err)
+	}
+	extra, err := parse.ParseInspectExtra(raw)
 	if err != nil {
-		logrus.Fatalf("inspecting container (%s) failed: %v", arg, err)
+		return err
+	}
+	if err := checkRunning(c, runningOnly); err != nil {
+		return err
+	}
+	if failOnHostNamespace {
+		if err := checkHostNamespaces(c, allowedHostNs); err != nil {
+			return err
+		}
+	}
+	if userFromImage {
+		if err := imageUser(cli, &c); err != nil {
+			return err
+		}
+	}
+
+	// look the names up where the container does, the host files say nothing
+	// about the users of the image
+	root := userRoot(c)
+	if validateUser && root == "" {
+		return fmt.Errorf("validating the user of container %s needs it running, its passwd and group files are read through its process", strings.TrimPrefix(c.Name, "/"))
 	}
 
 	t := native.New()
-	spec, err := parse.Config(c, runtime.GOOS, runtime.GOARCH, t.Capabilities, idroot, idlen)
+	opts := parse.Options{
+		Extra:                   extra,
+		Daemon:                  daemonInfo(cli),
+		OmitRootPath:            omitRootPath,
+		OmitDeprecatedFields:    !emitDeprecated,
+		StripAdditionalGids:     stripGids,
+		CapabilityNameStyle:     capNameStyle,
+		IdmapMounts:             idmapMounts,
+		ValidateUserExists:      validateUser,
+		UserRoot:                root,
+		ValidateRlimits:         validateRlimits,
+		DefaultMountsOrder:      defaultMountsOrder,
+		EmitCapabilitiesComment: capsComment,
+		SelinuxLabel:            selinuxLabel,
+		StrictMounts:            strictMounts,
+		Personality:             personality,
+		CgroupDriver:            cgroupDriver,
+		SpecVersion:             specVersion,
+	}
+	spec, err := parse.Config(c, runtime.GOOS, runtime.GOARCH, t.Capabilities, idroot, idlen, opts)
 	if err != nil {
-		logrus.Fatalf("Spec config conversion for %s failed: %v", arg, err)
+		return fmt.Errorf("Spec config conversion for %s failed: %v", id, err)
+	}
+
+	// refuse rlimits the kernel would not set
+	if validateRlimits {
+		if err := parse.ValidateRlimits(spec.Process.Rlimits); err != nil {
+			return err
+		}
+	}
+
+	// run the process the way docker runs the exec
+	if execConfig != nil {
+		before := spec.Process.Capabilities
+		if err := parse.ApplyExecConfig(spec, execConfig, execdriver.GetAllCapabilities(), opts); err != nil {
+			return err
+		}
+		parse.NoteCapabilities(spec, "exec", before)
+	}
+
+	// add the capabilities the required syscalls usually need
+	if len(syscalls) > 0 {
+		before := spec.Process.Capabilities
+		spec.Process.Capabilities, err = parse.AddSyscallCapabilities(spec.Process.Capabilities, syscalls, capNameStyle)
+		if err != nil {
+			return err
+		}
+		parse.NoteCapabilities(spec, "syscalls", before)
+	}
+
+	// add the capabilities the image says it needs
+	if capsImageLabel != "" {
+		caps, err := imageCapabilities(cli, c.Image, capsImageLabel)
+		if err != nil {
+			return err
+		}
+		before := spec.Process.Capabilities
+		spec.Process.Capabilities, err = parse.AddCapabilities(spec.Process.Capabilities, caps, capNameStyle, "the image label "+capsImageLabel+" lists it")
+		if err != nil {
+			return err
+		}
+		parse.NoteCapabilities(spec, "image label", before)
+	}
+
+	// only keep the capabilities the target kernel knows about
+	if capsIntersectKernel {
+		supported := []string(kernelCaps)
+		if len(supported) == 0 {
+			supported = execdriver.GetAllCapabilities()
+		}
+		before := spec.Process.Capabilities
+		spec.Process.Capabilities = parse.IntersectCapabilities(spec.Process.Capabilities, supported)
+		parse.NoteCapabilities(spec, "kernel", before)
+	}
+
+	// strip the capabilities the policy does not allow
+	if capsPolicy != "" {
+		policy, err := parse.LoadCapabilityPolicy(capsPolicy)
+		if err != nil {
+			return err
+		}
+		before := spec.Process.Capabilities
+		spec.Process.Capabilities, err = policy.Apply(spec.Process.Capabilities)
+		if err != nil {
+			return err
+		}
+		parse.NoteCapabilities(spec, "policy", before)
+	}
+
+	// drop every capability, whatever the steps above added
+	if noCaps {
+		parse.ClearCapabilities(spec)
+	}
+
+	// record the ambient capabilities
+	if err := parse.SetAmbientCapabilities(spec, ambientCaps, capNameStyle); err != nil {
+		return err
+	}
+
+	// warn about the capabilities that can be used to escape the container
+	parse.WarnDangerousCapabilities(spec.Process.Capabilities, c.HostConfig.Privileged, capsWarnPrivileged)
+
+	// warn about the mounts runtimes may not know how to mount
+	if validateMountTypes {
+		parse.WarnUnknownMountTypes(spec.Mounts)
+	}
+
+	// expand env references, if asked to
+	if envExpand {
+		spec.Process.Env, err = parse.ExpandEnv(spec.Process.Env, envExpandHost)
+		if err != nil {
+			return err
+		}
 	}
 
 	// fill in hooks, if passed through command line
 	spec.Hooks = hooks
-	if err := writeConfig(spec); err != nil {
-		logrus.Fatal(err)
+	parse.SetNetnsHookEnv(&spec.Hooks, c)
+
+	// point the root at the bundle when the config is written elsewhere
+	if err := bundleRoot(spec); err != nil {
+		return err
+	}
+
+	// print only a part of the spec for the diagnostic modes
+	if section, ok := onlySection(spec); ok {
+		if err := emitSection(stdout, section); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	// write only the hooks if asked to
+	name := specConfig
+	if runtimeHooksOnly {
+		name = runtimeConfig
+	}
+	if versionInFilename {
+		name = versionedFilename(name, spec.Version)
+	}
+
+	files := []string{filepath.Join(configDir(), name)}
+	if genHosts && hostsMount(spec) != nil {
+		files = append(files, filepath.Join(configDir(), hostsFile))
+	}
+	if capsAudit {
+		files = append(files, filepath.Join(configDir(), capsAuditFile))
+	}
+
+	// report what would be written instead of writing it
+	if dryRun {
+		return dryRunSummary(stderr, files, spec)
+	}
+
+	// make sure we don't already have any of the files before writing one of
+	// them, so an existing config does not leave the others behind
+	if !force {
+		for _, f := range files {
+			if err := checkNoFile(f); err != nil {
+				return err
+			}
+		}
+	}
+
+	// generate the hosts file, if asked to
+	if genHosts {
+		if err := writeHosts(spec, parse.Hosts(c, spec.Hostname)); err != nil {
+			return err
+		}
+	}
+
+	// write how each capability was decided on, if asked to
+	if capsAudit {
+		base := t.Capabilities
+		if c.HostConfig.Privileged {
+			base = execdriver.GetAllCapabilities()
+		}
+		audit, err := parse.AuditCapabilities(base, spec.Process.Capabilities, capNameStyle)
+		if err != nil {
+			return err
+		}
+		if err := writeCapabilitiesAudit(audit); err != nil {
+			return err
+		}
+	}
+
+	// windows containers take a command line instead of args, linux ones may
+	// need fields the spec types do not have, like idmapped mounts or the
+	// layout of a released spec version. The output is built last so it has
+	// the source of the hosts file
+	var out interface{}
+	switch {
+	case runtimeHooksOnly:
+		out = runtimeSpec{Hooks: spec.Hooks}
+	case parse.IsWindows(spec, extra):
+		out = parse.Windows(spec, c)
+	default:
+		out = parse.Linux(spec, opts)
+	}
+	if err := writeConfig(name, out); err != nil {
+		return err
 	}
 
-	fmt.Printf("%s has been saved.\n", specConfig)
+	fmt.Printf("%s has been saved.\n", name)
+	return nil
 }
 
 func usageAndExit(message string, exitCode int) {
 	if message != "" {
-		fmt.Fprintf(os.Stderr, message)
-		fmt.Fprintf(os.Stderr, "\n\n")
+		fmt.Fprint(os.Stderr, message)
+		fmt.Fprint(os.Stderr, "\n\n")
 	}
 	flag.Usage()
 	fmt.Fprintf(os.Stderr, "\n")
 	os.Exit(exitCode)
 }
 
+// userRoot returns the root of the filesystem of the running container, as
+// seen from the host through its init process, or empty if it is not
+// running and the names are looked up in the host files.
+func userRoot(c types.ContainerJSON) string {
+	if c.State == nil || c.State.Pid == 0 {
+		return ""
+	}
+	return fmt.Sprintf("/proc/%d/root", c.State.Pid)
+}
+
+// checkRunning warns when the container is not running, since some of the
+// inspect data is only filled in for running containers. If runningOnly is
+// true it returns an error instead.
+func checkRunning(c types.ContainerJSON, runningOnly bool) error {
+	if c.State != nil && c.State.Running {
+		return nil
+	}
+	name := strings.TrimPrefix(c.Name, "/")
+	if runningOnly {
+		return fmt.Errorf("container %s is not running", name)
+	}
+	logrus.Warnf("Container %s is not running, the generated spec may be incomplete", name)
+	return nil
+}
+
+// checkHostNamespaces returns an error if the container shares a namespace
+// with the host that is not in allowed.
+func checkHostNamespaces(c types.ContainerJSON, allowed []string) error {
+	ok := map[string]bool{}
+	for _, ns := range allowed {
+		ok[ns] = true
+	}
+	var shared []string
+	for _, ns := range parse.HostNamespaces(c.HostConfig) {
+		if !ok[string(ns)] {
+			shared = append(shared, string(ns))
+		}
+	}
+	if len(shared) > 0 {
+		return fmt.Errorf("container %s shares the %s namespaces with the host", strings.TrimPrefix(c.Name, "/"), strings.Join(shared, ", "))
+	}
+	return nil
+}
+
+// daemonInfo returns the info of the daemon, or nil if it can not be read so
+// the security features of the daemon are assumed.
+func daemonInfo(cli dockerClient) *parse.DaemonInfo {
+	raw, err := cli.InfoRaw(context.Background())
+	if err == nil {
+		var info *parse.DaemonInfo
+		if info, err = parse.ParseDaemonInfo(raw); err == nil {
+			return info
+		}
+	}
+	logrus.Warnf("Reading the daemon info failed, assuming seccomp and apparmor are enabled: %v", err)
+	return nil
+}
+
+// imageUser sets the user of the container to the user of its image, if the
+// container does not set one.
+func imageUser(cli dockerClient, c *types.ContainerJSON) error {
+	if c.Config.User != "" {
+		return nil
+	}
+	img, _, err := cli.ImageInspectWithRaw(context.Background(), c.Image, false)
+	if err != nil {
+		return fmt.Errorf("inspecting image (%s) failed: %v", c.Image, err)
+	}
+	if img.Config != nil {
+		c.Config.User = img.Config.User
+	}
+	return nil
+}
+
+// imageCapabilities returns the capabilities in the comma separated list of
+// the image label.
+func imageCapabilities(cli dockerClient, image, label string) ([]string, error) {
+	img, _, err := cli.ImageInspectWithRaw(context.Background(), image, false)
+	if err != nil {
+		return nil, fmt.Errorf("inspecting image (%s) failed: %v", image, err)
+	}
+	if img.Config == nil || img.Config.Labels[label] == "" {
+		logrus.Warnf("Image %s has no %s label, not adding capabilities", image, label)
+		return nil, nil
+	}
+
+	var caps []string
+	for _, c := range strings.Split(img.Config.Labels[label], ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			caps = append(caps, c)
+		}
+	}
+	return caps, nil
+}
+
 func checkNoFile(name string) error {
 	_, err := os.Stat(name)
 	if err == nil {
@@ -199,28 +834,238 @@ func checkNoFile(name string) error {
 	return nil
 }
 
-func writeConfig(spec *specs.Spec) error {
-	if bundle != "" {
+// createBundle creates the bundle directory with the given permissions, if
+// it does not exist yet.
+func createBundle(path string, perm os.FileMode) error {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(path, perm); err != nil {
+		return fmt.Errorf("creating bundle directory %s failed: %v", path, err)
+	}
+	// make sure the mode is not masked by the umask
+	return os.Chmod(path, perm)
+}
+
+// writeHosts writes the hosts file next to the config and points the /etc/hosts
+// mount of the spec at it.
+func writeHosts(spec *specs.Spec, data []byte) error {
+	mount := hostsMount(spec)
+	if mount == nil {
+		logrus.Warn("Not generating a hosts file, the container does not mount /etc/hosts")
+		return nil
+	}
+
+	dir := configDir()
+	if dir != "" {
+		if err := createBundle(dir, bundlePerm); err != nil {
+			return err
+		}
+	}
+	path, err := filepath.Abs(filepath.Join(dir, hostsFile))
+	if err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	mount.Source = path
+	return nil
+}
+
+// hostsMount returns the /etc/hosts mount of the spec, nil if it has none.
+func hostsMount(spec *specs.Spec) *specs.Mount {
+	var mount *specs.Mount
+	for i := range spec.Mounts {
+		if spec.Mounts[i].Destination == "/etc/hosts" {
+			mount = &spec.Mounts[i]
+		}
+	}
+	return mount
+}
+
+// writeCapabilitiesAudit writes the capability audit as JSON to the output
+// directory.
+func writeCapabilitiesAudit(audit []parse.CapabilityAudit) error {
+	dir := configDir()
+	if dir != "" {
+		if err := createBundle(dir, bundlePerm); err != nil {
+			return err
+		}
+	}
+	path := filepath.Join(dir, capsAuditFile)
+	data, err := json.MarshalIndent(audit, "", "    ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// dryRunSummary writes the files that would be written and the main fields of
+// the spec to w.
+func dryRunSummary(w io.Writer, files []string, spec *specs.Spec) error {
+	var b bytes.Buffer
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil && !force {
+			fmt.Fprintf(&b, "would write %s, it exists so --force is needed\n", f)
+			continue
+		}
+		fmt.Fprintf(&b, "would write %s\n", f)
+	}
+
+	var namespaces []string
+	for _, ns := range spec.Linux.Namespaces {
+		namespaces = append(namespaces, string(ns.Type))
+	}
+	fmt.Fprintf(&b, "hostname: %s\n", spec.Hostname)
+	fmt.Fprintf(&b, "args: %s\n", strings.Join(spec.Process.Args, " "))
+	fmt.Fprintf(&b, "user: %d:%d\n", spec.Process.User.UID, spec.Process.User.GID)
+	fmt.Fprintf(&b, "root: %s (readonly %v)\n", spec.Root.Path, spec.Root.Readonly)
+	fmt.Fprintf(&b, "capabilities: %d\n", len(spec.Process.Capabilities))
+	fmt.Fprintf(&b, "mounts: %d\n", len(spec.Mounts))
+	fmt.Fprintf(&b, "namespaces: %s\n", strings.Join(namespaces, ", "))
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// onlySection returns the part of the spec the emit only flags ask for, if
+// any of them is set.
+func onlySection(spec *specs.Spec) (interface{}, bool) {
+	switch {
+	case emitAnnotationsOnly:
+		if spec.Annotations == nil {
+			return map[string]string{}, true
+		}
+		return spec.Annotations, true
+	case emitResourcesOnly:
+		if spec.Linux.Resources == nil {
+			return &specs.Resources{}, true
+		}
+		return spec.Linux.Resources, true
+	case emitNamespacesOnly:
+		if spec.Linux.Namespaces == nil {
+			return []specs.Namespace{}, true
+		}
+		return spec.Linux.Namespaces, true
+	case emitProcessOnly:
+		return spec.Process, true
+	case emitHooksOnly:
+		return spec.Hooks, true
+	case emitRootOnly:
+		return spec.Root, true
+	case emitLinuxOnly:
+		return spec.Linux, true
+	}
+	return nil, false
+}
+
+// emitSection writes a part of the spec to w as indented JSON.
+func emitSection(w io.Writer, section interface{}) error {
+	v := section
+	if sortKeys {
+		v = sortedJSON{section}
+	}
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// runtimeSpec is a runtime.json with only the hooks of the spec.
+type runtimeSpec struct {
+	Hooks specs.Hooks `json:"hooks"`
+}
+
+// versionedFilename returns the name of a JSON file with the spec version
+// before the extension.
+func versionedFilename(name, version string) string {
+	return strings.TrimSuffix(name, ".json") + ".v" + version + ".json"
+}
+
+// configDir returns the directory the config files are written to.
+func configDir() string {
+	if outputDir != "" {
+		return outputDir
+	}
+	return bundle
+}
+
+// bundleRoot makes the root path of the spec absolute when the config files
+// are not written to the bundle, a relative path would be resolved against
+// the directory of the config instead.
+func bundleRoot(spec *specs.Spec) error {
+	if outputDir == "" || spec.Root.Path == "" || filepath.IsAbs(spec.Root.Path) {
+		return nil
+	}
+	path, err := filepath.Abs(filepath.Join(bundle, spec.Root.Path))
+	if err != nil {
+		return err
+	}
+	spec.Root.Path = path
+	return nil
+}
+
+// writeConfig writes the spec as JSON to the file name in the output
+// directory.
+func writeConfig(name string, spec interface{}) error {
+	if dir := configDir(); dir != "" {
+		if err := createBundle(dir, bundlePerm); err != nil {
+			return err
+		}
+
 		// change current working directory
-		if err := os.Chdir(bundle); err != nil {
-			return fmt.Errorf("change working directory to %s failed: %v", bundle, err)
+		if err := os.Chdir(dir); err != nil {
+			return fmt.Errorf("change working directory to %s failed: %v", dir, err)
 		}
 	}
 
 	// make sure we don't already have files, we would not want to overwrite them
 	if !force {
-		if err := checkNoFile(specConfig); err != nil {
+		if err := checkNoFile(name); err != nil {
 			return err
 		}
 	}
 
-	data, err := json.MarshalIndent(&spec, "", "    ")
+	// maps like the annotations are always written in sorted key order, so
+	// the flag is only needed to sort the fields of the structs too
+	v := spec
+	if sortKeys {
+		v = sortedJSON{spec}
+	}
+	data, err := json.MarshalIndent(v, "", "    ")
 	if err != nil {
 		return err
 	}
-	if err := ioutil.WriteFile(specConfig, data, 0666); err != nil {
+	if err := ioutil.WriteFile(name, data, 0666); err != nil {
 		return err
 	}
 
 	return nil
 }
+
+// sortedJSON marshals the value it wraps with the keys of every object sorted,
+// struct fields included, so the output does not depend on field order.
+type sortedJSON struct {
+	v interface{}
+}
+
+func (s sortedJSON) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(s.v)
+	if err != nil {
+		return nil, err
+	}
+
+	// decode into maps, which encoding/json always marshals in key order,
+	// keeping numbers as is so large values do not lose precision
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
+}
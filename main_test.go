@@ -0,0 +1,779 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/context"
+
+	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/container"
+	"github.com/jessfraz/riddler/parse"
+	specs "github.com/opencontainers/specs/specs-go"
+)
+
+// checkSortedKeys walks the next JSON value in dec and fails if the keys of
+// any of its objects are not in sorted order.
+func checkSortedKeys(t *testing.T, dec *json.Decoder) {
+	tok, err := dec.Token()
+	if err != nil {
+		t.Fatal(err)
+	}
+	switch tok {
+	case json.Delim('{'):
+		var keys []string
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys = append(keys, key.(string))
+			checkSortedKeys(t, dec)
+		}
+		if !sort.StringsAreSorted(keys) {
+			t.Fatalf("expected sorted keys, got %v", keys)
+		}
+		dec.Token()
+	case json.Delim('['):
+		for dec.More() {
+			checkSortedKeys(t, dec)
+		}
+		dec.Token()
+	}
+}
+
+func TestSortedJSON(t *testing.T) {
+	limit := uint64(18446744073709551615)
+	spec := &specs.Spec{
+		Version:  "1.0.0-rc3",
+		Hostname: "riddler",
+		Process: specs.Process{
+			Args: []string{"sh"},
+			Cwd:  "/",
+		},
+		Mounts: []specs.Mount{
+			{
+				Destination: "/proc",
+				Type:        "proc",
+				Source:      "proc",
+			},
+		},
+		Linux: specs.Linux{
+			Resources: &specs.Resources{
+				Memory: &specs.Memory{
+					Limit: &limit,
+				},
+			},
+		},
+	}
+
+	data, err := json.MarshalIndent(sortedJSON{spec}, "", "    ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSortedKeys(t, json.NewDecoder(bytes.NewReader(data)))
+
+	// make sure large numbers survive the round trip
+	if !bytes.Contains(data, []byte(`"limit": 18446744073709551615`)) {
+		t.Fatalf("expected memory limit to be kept, got:\n%s", data)
+	}
+}
+
+func TestSortedAnnotations(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "riddler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	bundle, bundlePerm = tmp, 0755
+	defer func() { bundle, bundlePerm = "", 0 }()
+
+	spec := &specs.Spec{Annotations: map[string]string{}}
+	for i := 0; i < 32; i++ {
+		spec.Annotations[fmt.Sprintf("org.example.%c", 'z'-i%26)+strings.Repeat("x", i)] = "v"
+	}
+	if err := writeConfig(specConfig, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(tmp, specConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written struct {
+		Annotations json.RawMessage `json:"annotations"`
+	}
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	checkSortedKeys(t, json.NewDecoder(bytes.NewReader(written.Annotations)))
+}
+
+func TestUserRoot(t *testing.T) {
+	c := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Name:  "/web",
+			State: &types.ContainerState{},
+		},
+	}
+	if root := userRoot(c); root != "" {
+		t.Fatalf("expected the host files for a container that is not running, got %s", root)
+	}
+
+	c.State.Pid = 42
+	if root := userRoot(c); root != "/proc/42/root" {
+		t.Fatalf("expected root /proc/42/root, got %s", root)
+	}
+}
+
+func TestCheckRunning(t *testing.T) {
+	stopped := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Name:  "/stopped",
+			State: &types.ContainerState{Status: "exited"},
+		},
+	}
+	running := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Name:  "/running",
+			State: &types.ContainerState{Status: "running", Running: true},
+		},
+	}
+
+	if err := checkRunning(stopped, true); err == nil {
+		t.Fatal("expected error for stopped container")
+	}
+	if err := checkRunning(stopped, false); err != nil {
+		t.Fatalf("expected only a warning for stopped container, got: %v", err)
+	}
+	if err := checkRunning(running, true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckHostNamespaces(t *testing.T) {
+	c := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			Name:       "/web",
+			HostConfig: &container.HostConfig{NetworkMode: "host"},
+		},
+	}
+
+	if err := checkHostNamespaces(c, nil); err == nil {
+		t.Fatal("expected error for host networking")
+	}
+	if err := checkHostNamespaces(c, []string{"network"}); err != nil {
+		t.Fatalf("expected host networking to be allowed, got: %v", err)
+	}
+
+	c.HostConfig.NetworkMode = "bridge"
+	if err := checkHostNamespaces(c, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateBundle(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "riddler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	dir := filepath.Join(tmp, "bundle")
+	if err := createBundle(dir, 0750); err != nil {
+		t.Fatal(err)
+	}
+
+	fi, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !fi.IsDir() || fi.Mode().Perm() != 0750 {
+		t.Fatalf("expected directory with mode 0750, got %v", fi.Mode())
+	}
+
+	// existing directories are left alone
+	if err := createBundle(dir, 0700); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// fakeClient is a dockerClient serving canned inspect data.
+type fakeClient struct {
+	containers map[string]types.ContainerJSON
+	// raw is the inspect JSON of the containers, if it is not set the
+	// containers are marshaled instead
+	raw    map[string][]byte
+	images map[string]types.ImageInspect
+	info   []byte
+	list   []types.Container
+}
+
+func (f *fakeClient) ContainerInspectWithRaw(ctx context.Context, containerID string, getSize bool) (types.ContainerJSON, []byte, error) {
+	c, ok := f.containers[containerID]
+	if !ok {
+		return c, nil, fmt.Errorf("no such container: %s", containerID)
+	}
+	if raw, ok := f.raw[containerID]; ok {
+		return c, raw, nil
+	}
+	raw, err := json.Marshal(c)
+	return c, raw, err
+}
+
+func (f *fakeClient) ImageInspectWithRaw(ctx context.Context, imageID string, getSize bool) (types.ImageInspect, []byte, error) {
+	img, ok := f.images[imageID]
+	if !ok {
+		return img, nil, fmt.Errorf("no such image: %s", imageID)
+	}
+	raw, err := json.Marshal(img)
+	return img, raw, err
+}
+
+func (f *fakeClient) InfoRaw(ctx context.Context) ([]byte, error) {
+	if f.info == nil {
+		return nil, fmt.Errorf("cannot connect to the daemon")
+	}
+	return f.info, nil
+}
+
+func (f *fakeClient) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	var matched []types.Container
+	for _, c := range f.list {
+		if options.Filter.MatchKVList("label", c.Labels) {
+			matched = append(matched, c)
+		}
+	}
+	return matched, nil
+}
+
+func TestListContainers(t *testing.T) {
+	cli := &fakeClient{
+		list: []types.Container{
+			{ID: "1", Names: []string{"/web1"}, Labels: map[string]string{"app": "web", "tier": "front"}},
+			{ID: "2", Names: []string{"/db"}, Labels: map[string]string{"app": "db"}},
+			{ID: "3", Names: []string{"/web2"}, Labels: map[string]string{"app": "web"}},
+		},
+	}
+
+	containers, err := listContainers(cli, []string{"app=web"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, c := range containers {
+		names = append(names, c.Names[0])
+	}
+	expected := []string{"/web1", "/web2"}
+	if !reflect.DeepEqual(expected, names) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, names)
+	}
+
+	containers, err = listContainers(cli, []string{"app=web", "tier"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(containers) != 1 || containers[0].ID != "1" {
+		t.Fatalf("expected only web1, got %#v", containers)
+	}
+}
+
+func TestDaemonInfo(t *testing.T) {
+	info := daemonInfo(&fakeClient{info: []byte(`{"SecurityOptions": ["name=apparmor"]}`)})
+	if info == nil || info.SecurityOption("seccomp") || !info.SecurityOption("apparmor") {
+		t.Fatalf("expected only apparmor enabled, got %#v", info)
+	}
+
+	// without daemon info every feature is assumed
+	info = daemonInfo(&fakeClient{})
+	if info != nil || !info.SecurityOption("seccomp") {
+		t.Fatalf("expected no daemon info, got %#v", info)
+	}
+}
+
+func TestImageCapabilities(t *testing.T) {
+	cli := &fakeClient{
+		images: map[string]types.ImageInspect{
+			"sha256:7328f6f8b418": {
+				Config: &container.Config{Labels: map[string]string{
+					"org.example.capabilities": "NET_ADMIN, SYS_TIME",
+					"org.example.other":        "SYS_ADMIN",
+				}},
+			},
+		},
+	}
+
+	caps, err := imageCapabilities(cli, "sha256:7328f6f8b418", "org.example.capabilities")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"NET_ADMIN", "SYS_TIME"}
+	if !reflect.DeepEqual(expected, caps) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, caps)
+	}
+
+	caps, err = imageCapabilities(cli, "sha256:7328f6f8b418", "org.example.missing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(caps) != 0 {
+		t.Fatalf("expected no capabilities for a missing label, got %v", caps)
+	}
+}
+
+func TestImageUser(t *testing.T) {
+	cli := &fakeClient{
+		images: map[string]types.ImageInspect{
+			"sha256:7328f6f8b418": {
+				Config: &container.Config{User: "nobody"},
+			},
+		},
+	}
+	c := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{Image: "sha256:7328f6f8b418"},
+		Config:            &container.Config{},
+	}
+
+	if err := imageUser(cli, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Config.User != "nobody" {
+		t.Fatalf("expected user nobody from the image, got %q", c.Config.User)
+	}
+
+	// the user of the container wins over the one of the image
+	c.Config.User = "daemon"
+	if err := imageUser(cli, &c); err != nil {
+		t.Fatal(err)
+	}
+	if c.Config.User != "daemon" {
+		t.Fatalf("expected user daemon from the container, got %q", c.Config.User)
+	}
+}
+
+type emitOnly struct {
+	flag *bool
+	// path is where the section is in the config.json
+	path []string
+}
+
+func TestEmitOnly(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "riddler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	var buf bytes.Buffer
+	bundle, stdout, bundlePerm = tmp, &buf, 0755
+	hooks = specs.Hooks{Prestart: []specs.Hook{{Path: "/usr/local/bin/netns"}}}
+	defer func() { bundle, stdout, bundlePerm, hooks = "", os.Stdout, 0, specs.Hooks{} }()
+
+	swappiness := int64(-1)
+	cli := &fakeClient{
+		containers: map[string]types.ContainerJSON{
+			"web": {
+				ContainerJSONBase: &types.ContainerJSONBase{
+					ID:    "4d2a3c1e8b7f6a5d4c3b2a1f0e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d",
+					Name:  "/web",
+					Path:  "nginx",
+					State: &types.ContainerState{Running: true},
+					HostConfig: &container.HostConfig{
+						NetworkMode:   "default",
+						RestartPolicy: container.RestartPolicy{Name: "always"},
+						Resources:     container.Resources{Memory: 512 * 1024 * 1024, MemorySwappiness: &swappiness},
+					},
+				},
+				Config: &container.Config{Hostname: "4d2a3c1e8b7f", User: "1000:1000", Env: []string{"TERM=xterm"}},
+			},
+		},
+	}
+
+	// the config.json the sections are compared with
+	if err := generate(cli, "web"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(tmp, specConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+
+	tests := []emitOnly{
+		{flag: &emitAnnotationsOnly, path: []string{"annotations"}},
+		{flag: &emitResourcesOnly, path: []string{"linux", "resources"}},
+		{flag: &emitNamespacesOnly, path: []string{"linux", "namespaces"}},
+		{flag: &emitProcessOnly, path: []string{"process"}},
+		{flag: &emitHooksOnly, path: []string{"hooks"}},
+		{flag: &emitRootOnly, path: []string{"root"}},
+		{flag: &emitLinuxOnly, path: []string{"linux"}},
+	}
+	for _, test := range tests {
+		*test.flag = true
+		err := generate(cli, "web")
+		*test.flag = false
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		section := json.RawMessage(data)
+		for _, key := range test.path {
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(section, &fields); err != nil {
+				t.Fatal(err)
+			}
+			section = fields[key]
+		}
+		var expected, got interface{}
+		if err := json.Unmarshal(section, &expected); err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("expected the %s section as JSON, got:\n%s", strings.Join(test.path, "."), buf.String())
+		}
+		if expected == nil || !reflect.DeepEqual(expected, got) {
+			t.Fatalf("expected the %s section:\n%s\ngot:\n%s", strings.Join(test.path, "."), section, buf.String())
+		}
+		buf.Reset()
+	}
+
+	// a spec without annotations still prints an object
+	emitAnnotationsOnly = true
+	section, _ := onlySection(&specs.Spec{})
+	emitAnnotationsOnly = false
+	if err := emitSection(&buf, section); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "{}\n" {
+		t.Fatalf("expected an empty object for no annotations, got:\n%s", buf.String())
+	}
+}
+
+func TestRuntimeHooksOnly(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "riddler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	bundle = tmp
+	defer func() { bundle = "" }()
+
+	spec := &specs.Spec{
+		Hostname: "test",
+		Hooks: specs.Hooks{
+			Prestart: []specs.Hook{{Path: "/usr/bin/netns"}},
+		},
+	}
+	if err := writeConfig(runtimeConfig, runtimeSpec{Hooks: spec.Hooks}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(tmp, runtimeConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var runtime map[string]json.RawMessage
+	if err := json.Unmarshal(data, &runtime); err != nil {
+		t.Fatal(err)
+	}
+	if len(runtime) != 1 {
+		t.Fatalf("expected only hooks in %s, got:\n%s", runtimeConfig, data)
+	}
+	var hooks specs.Hooks
+	if err := json.Unmarshal(runtime["hooks"], &hooks); err != nil {
+		t.Fatal(err)
+	}
+	if len(hooks.Prestart) != 1 || hooks.Prestart[0].Path != "/usr/bin/netns" {
+		t.Fatalf("expected the prestart hook, got:\n%s", data)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, specConfig)); !os.IsNotExist(err) {
+		t.Fatalf("expected no %s, got: %v", specConfig, err)
+	}
+}
+
+func TestOutputDir(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "riddler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	bundle = filepath.Join(tmp, "bundle")
+	outputDir = filepath.Join(tmp, "out")
+	bundlePerm = 0755
+	defer func() { bundle, outputDir, bundlePerm = "", "", 0 }()
+
+	spec := &specs.Spec{Root: specs.Root{Path: "rootfs"}}
+	if err := bundleRoot(spec); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeConfig(specConfig, spec); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(outputDir, specConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written specs.Spec
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join(bundle, "rootfs"); written.Root.Path != expected {
+		t.Fatalf("expected root path %s, got %s", expected, written.Root.Path)
+	}
+	if _, err := os.Stat(filepath.Join(bundle, specConfig)); !os.IsNotExist(err) {
+		t.Fatalf("expected no %s in the bundle, got: %v", specConfig, err)
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "riddler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	var buf bytes.Buffer
+	bundle, dryRun, stderr = tmp, true, &buf
+	defer func() { bundle, dryRun, stderr = "", false, os.Stderr }()
+
+	swappiness := int64(-1)
+	cli := &fakeClient{
+		containers: map[string]types.ContainerJSON{
+			"web": {
+				ContainerJSONBase: &types.ContainerJSONBase{
+					ID:    "4d2a3c1e8b7f6a5d4c3b2a1f0e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d",
+					Name:  "/web",
+					Path:  "nginx",
+					State: &types.ContainerState{Running: true},
+					HostConfig: &container.HostConfig{
+						NetworkMode: "default",
+						Resources:   container.Resources{MemorySwappiness: &swappiness},
+					},
+				},
+				Config: &container.Config{Hostname: "4d2a3c1e8b7f"},
+			},
+		},
+	}
+	if err := generate(cli, "web"); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 0 {
+		t.Fatalf("expected no files in the bundle, got %d", len(files))
+	}
+	summary := buf.String()
+	for _, line := range []string{
+		"would write " + filepath.Join(tmp, specConfig) + "\n",
+		"hostname: 4d2a3c1e8b7f\n",
+		"args: nginx\n",
+	} {
+		if !strings.Contains(summary, line) {
+			t.Fatalf("expected the summary to contain %q, got:\n%s", line, summary)
+		}
+	}
+}
+
+type versionedName struct {
+	name     string
+	version  string
+	expected string
+}
+
+func TestVersionedFilename(t *testing.T) {
+	tests := []versionedName{
+		{name: specConfig, version: "1.0.0-rc3", expected: "config.v1.0.0-rc3.json"},
+		{name: specConfig, version: "1.0", expected: "config.v1.0.json"},
+		{name: runtimeConfig, version: "1.0.0-rc3", expected: "runtime.v1.0.0-rc3.json"},
+	}
+
+	for _, test := range tests {
+		if name := versionedFilename(test.name, test.version); name != test.expected {
+			t.Fatalf("expected %s for %s at %s, got %s", test.expected, test.name, test.version, name)
+		}
+	}
+}
+
+func TestCapabilitiesAudit(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "riddler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	bundle, bundlePerm, capsAudit = tmp, 0755, true
+	defer func() { bundle, bundlePerm, capsAudit = "", 0, false }()
+
+	swappiness := int64(-1)
+	cli := &fakeClient{
+		containers: map[string]types.ContainerJSON{
+			"web": {
+				ContainerJSONBase: &types.ContainerJSONBase{
+					ID:    "4d2a3c1e8b7f6a5d4c3b2a1f0e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d",
+					Name:  "/web",
+					Path:  "nginx",
+					State: &types.ContainerState{Running: true},
+					HostConfig: &container.HostConfig{
+						NetworkMode: "default",
+						CapAdd:      []string{"NET_ADMIN"},
+						CapDrop:     []string{"MKNOD"},
+						Resources:   container.Resources{MemorySwappiness: &swappiness},
+					},
+				},
+				Config: &container.Config{Hostname: "4d2a3c1e8b7f"},
+			},
+		},
+	}
+	if err := generate(cli, "web"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(tmp, capsAuditFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var audit []map[string]interface{}
+	if err := json.Unmarshal(data, &audit); err != nil {
+		t.Fatal(err)
+	}
+	decisions := map[string]map[string]interface{}{}
+	for _, a := range audit {
+		decisions[a["name"].(string)] = a
+	}
+
+	expected := map[string]map[string]interface{}{
+		"CAP_CHOWN":     {"name": "CAP_CHOWN", "base": true, "added": false, "dropped": false, "final": true},
+		"CAP_MKNOD":     {"name": "CAP_MKNOD", "base": true, "added": false, "dropped": true, "final": false},
+		"CAP_NET_ADMIN": {"name": "CAP_NET_ADMIN", "base": false, "added": true, "dropped": false, "final": true},
+	}
+	for name, e := range expected {
+		if !reflect.DeepEqual(e, decisions[name]) {
+			t.Fatalf("expected:\n%#v\ngot:\n%#v", e, decisions[name])
+		}
+	}
+
+	// an existing config is refused before the audit is written
+	for _, f := range []string{specConfig, capsAuditFile} {
+		os.Remove(filepath.Join(tmp, f))
+	}
+	if err := ioutil.WriteFile(filepath.Join(tmp, specConfig), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := generate(cli, "web"); err == nil {
+		t.Fatal("expected error for an existing config")
+	}
+	if _, err := os.Stat(filepath.Join(tmp, capsAuditFile)); !os.IsNotExist(err) {
+		t.Fatalf("expected no capabilities audit next to an existing config, got: %v", err)
+	}
+}
+
+func TestIdmapMounts(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "riddler")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	bundle, bundlePerm, idmapMounts = tmp, 0755, true
+	defer func() { bundle, bundlePerm, idmapMounts, specVersion = "", 0, false, "" }()
+
+	swappiness := int64(-1)
+	cli := &fakeClient{
+		containers: map[string]types.ContainerJSON{
+			"web": {
+				ContainerJSONBase: &types.ContainerJSONBase{
+					ID:    "4d2a3c1e8b7f6a5d4c3b2a1f0e9d8c7b6a5f4e3d2c1b0a9f8e7d6c5b4a3f2e1d",
+					Name:  "/web",
+					Path:  "nginx",
+					State: &types.ContainerState{Running: true},
+					HostConfig: &container.HostConfig{
+						NetworkMode: "default",
+						Resources:   container.Resources{MemorySwappiness: &swappiness},
+					},
+				},
+				Mounts: []types.MountPoint{{Source: "/srv/data", Destination: "/data", RW: true}},
+				Config: &container.Config{Hostname: "4d2a3c1e8b7f"},
+			},
+		},
+	}
+
+	// the default spec version predates idmapped mounts
+	specVersion = parse.SpecVersion
+	if err := generate(cli, "web"); err == nil || !strings.Contains(err.Error(), parse.MinIdmapMountsVersion) {
+		t.Fatalf("expected spec version error for idmapped mounts, got: %v", err)
+	}
+
+	specVersion = "1.1.0"
+	if err := generate(cli, "web"); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(tmp, specConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var spec parse.LinuxSpec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		t.Fatal(err)
+	}
+	if spec.Version != "1.1.0" {
+		t.Fatalf("expected spec version 1.1.0, got %s", spec.Version)
+	}
+	var idmapped bool
+	for _, m := range spec.Mounts {
+		if m.Destination != "/data" {
+			continue
+		}
+		idmapped = true
+		if m.Options[len(m.Options)-1] != "idmap" || len(m.UIDMappings) == 0 || len(m.GIDMappings) == 0 {
+			t.Fatalf("expected /data to be idmapped, got %#v", m)
+		}
+	}
+	if !idmapped {
+		t.Fatalf("expected the /data mount, got:\n%s", data)
+	}
+}
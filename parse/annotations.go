@@ -0,0 +1,70 @@
+package parse
+
+import "github.com/opencontainers/specs/specs-go"
+
+const (
+	// AnnotationPrefix is the prefix for the annotations riddler records for
+	// container settings the spec has no field for.
+	AnnotationPrefix = "com.github.jessfraz.riddler."
+
+	// AnnotationHealthcheck is the healthcheck command, as a JSON array of args.
+	AnnotationHealthcheck = AnnotationPrefix + "healthcheck"
+
+	// AnnotationRuntime is the OCI runtime the daemon runs the container with,
+	// from --runtime.
+	AnnotationRuntime = AnnotationPrefix + "runtime"
+
+	// AnnotationVolumeDriver is the driver for the anonymous volumes of the
+	// container, from --volume-driver.
+	AnnotationVolumeDriver = AnnotationPrefix + "volume-driver"
+
+	// AnnotationVolumesNoCopy is the comma separated destinations of the
+	// volumes mounted with nocopy, which are not populated with the image
+	// data at the destination when they are created.
+	AnnotationVolumesNoCopy = AnnotationPrefix + "volumes.nocopy"
+
+	// AnnotationAmbientCapabilities is the comma separated ambient
+	// capabilities of the process. The spec version riddler generates has a
+	// single capability list for every set, so runtimes that raise ambient
+	// capabilities read them from here.
+	AnnotationAmbientCapabilities = AnnotationPrefix + "capabilities.ambient"
+
+	// AnnotationCapabilitiesDerivation explains how the capabilities of the
+	// process were derived from the template, cap adds and cap drops, and the
+	// steps that changed them after.
+	AnnotationCapabilitiesDerivation = AnnotationPrefix + "capabilities.derivation"
+
+	// AnnotationMacAddress is the mac address of the container, the one it
+	// was configured with or else the one the daemon assigned.
+	AnnotationMacAddress = AnnotationPrefix + "mac-address"
+
+	// AnnotationExposedPorts is the comma separated ports the container
+	// exposes, as port/proto with proto one of tcp, udp or sctp.
+	AnnotationExposedPorts = AnnotationPrefix + "exposed-ports"
+
+	// AnnotationPortBindings is the comma separated ports the container
+	// publishes on the host, as [hostIP:][hostPort:]containerPort/proto with
+	// port ranges expanded.
+	AnnotationPortBindings = AnnotationPrefix + "port-bindings"
+
+	// AnnotationRestartPolicy is the restart policy of the container, one of
+	// no, always, unless-stopped or on-failure.
+	AnnotationRestartPolicy = AnnotationPrefix + "restart-policy"
+	// AnnotationRestartMaxRetries is the maximum number of restarts for the
+	// on-failure restart policy.
+	AnnotationRestartMaxRetries = AnnotationPrefix + "restart-policy.max-retries"
+)
+
+// AnnotationNetworkAliases returns the annotation for the comma separated
+// aliases of the container on the network.
+func AnnotationNetworkAliases(network string) string {
+	return AnnotationPrefix + "network." + network + ".aliases"
+}
+
+// setAnnotation sets an annotation on the spec, creating the map if needed.
+func setAnnotation(config *specs.Spec, key, value string) {
+	if config.Annotations == nil {
+		config.Annotations = map[string]string{}
+	}
+	config.Annotations[key] = value
+}
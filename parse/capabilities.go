@@ -0,0 +1,305 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/docker/daemon/execdriver"
+	"github.com/opencontainers/specs/specs-go"
+)
+
+const (
+	// CapabilityStylePrefixed names capabilities with the CAP_ prefix, as runc
+	// expects them.
+	CapabilityStylePrefixed = "prefixed"
+	// CapabilityStyleShort names capabilities without the CAP_ prefix, as
+	// docker does.
+	CapabilityStyleShort = "short"
+)
+
+// prefixedNames maps the capabilities the kernel knows about to their CAP_
+// prefixed names, so naming them does not build the same strings every time.
+var prefixedNames = map[string]string{}
+
+func init() {
+	for _, c := range execdriver.GetAllCapabilities() {
+		prefixedNames[c] = "CAP_" + c
+	}
+}
+
+// dangerousCapabilities are the capabilities that let a process escape the
+// container or take over the host, without the CAP_ prefix.
+var dangerousCapabilities = map[string]bool{
+	"DAC_READ_SEARCH": true,
+	"MAC_ADMIN":       true,
+	"MAC_OVERRIDE":    true,
+	"NET_ADMIN":       true,
+	"SYS_ADMIN":       true,
+	"SYS_BOOT":        true,
+	"SYS_MODULE":      true,
+	"SYS_PTRACE":      true,
+	"SYS_RAWIO":       true,
+	"SYS_TIME":        true,
+}
+
+// WarnDangerousCapabilities warns about each dangerous capability in caps. A
+// privileged container has all of them on purpose, if skipPrivileged is true
+// it gets a single warning instead of one per capability.
+func WarnDangerousCapabilities(caps []string, privileged, skipPrivileged bool) {
+	if privileged && skipPrivileged {
+		logrus.Warn("Container is privileged, it has every capability")
+		return
+	}
+	for _, c := range caps {
+		if dangerousCapabilities[capabilityKey(c)] {
+			logrus.Warnf("Capability %s is dangerous, it can be used to escape the container", c)
+		}
+	}
+}
+
+// CapabilityPolicy is an org wide policy of the capabilities a spec may keep.
+type CapabilityPolicy struct {
+	// Allowed are the capabilities a spec may keep.
+	Allowed []string `json:"allowed"`
+	// Reject makes capabilities outside the policy an error instead of
+	// stripping them.
+	Reject bool `json:"reject,omitempty"`
+}
+
+// LoadCapabilityPolicy reads a capability policy from a JSON file.
+func LoadCapabilityPolicy(path string) (*CapabilityPolicy, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading capability policy %s failed: %v", path, err)
+	}
+	var policy CapabilityPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("parsing capability policy %s failed: %v", path, err)
+	}
+	return &policy, nil
+}
+
+// Apply returns the capabilities in caps that the policy allows.
+func (p *CapabilityPolicy) Apply(caps []string) ([]string, error) {
+	kept, dropped := filterCapabilities(caps, p.Allowed)
+	if len(dropped) > 0 && p.Reject {
+		return nil, fmt.Errorf("capabilities %s are not allowed by the capability policy", strings.Join(dropped, ", "))
+	}
+	for _, c := range dropped {
+		logrus.Warnf("Dropping capability %s, it is not allowed by the capability policy", c)
+	}
+	return kept, nil
+}
+
+// IntersectCapabilities returns the capabilities in caps that are also in
+// supported. Names are compared without the CAP_ prefix so either style works.
+func IntersectCapabilities(caps, supported []string) []string {
+	kept, dropped := filterCapabilities(caps, supported)
+	for _, c := range dropped {
+		logrus.Warnf("Dropping capability %s, it is not supported by the kernel", c)
+	}
+	return kept
+}
+
+// filterCapabilities splits caps into the ones that are in allowed and the
+// ones that are not.
+func filterCapabilities(caps, allowed []string) (kept, dropped []string) {
+	ok := map[string]bool{}
+	for _, c := range allowed {
+		ok[capabilityKey(c)] = true
+	}
+
+	kept = []string{}
+	for _, c := range caps {
+		if !ok[capabilityKey(c)] {
+			dropped = append(dropped, c)
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept, dropped
+}
+
+// SetAmbientCapabilities records the ambient capabilities of the process,
+// named in the given style. Ambient capabilities have to be permitted and
+// inheritable, so each of them must be in the capabilities of the process.
+func SetAmbientCapabilities(config *specs.Spec, ambient []string, style string) error {
+	if len(ambient) == 0 {
+		return nil
+	}
+	if err := checkCapabilities(ambient); err != nil {
+		return err
+	}
+	_, missing := filterCapabilities(ambient, config.Process.Capabilities)
+	if len(missing) > 0 {
+		return fmt.Errorf("ambient capabilities %s are not capabilities of the process", strings.Join(missing, ", "))
+	}
+	names, err := StyleCapabilities(ambient, style)
+	if err != nil {
+		return err
+	}
+	setAnnotation(config, AnnotationAmbientCapabilities, strings.Join(names, ","))
+	return nil
+}
+
+// ClearCapabilities leaves the process without any capabilities. The spec has
+// a single list for the bounding, effective, inheritable and permitted sets,
+// so emptying it empties all of them, and the derivation note no longer
+// applies.
+func ClearCapabilities(config *specs.Spec) {
+	config.Process.Capabilities = []string{}
+	delete(config.Annotations, AnnotationCapabilitiesDerivation)
+}
+
+// CapabilityAudit is how riddler decided on a capability of the process.
+type CapabilityAudit struct {
+	Name string `json:"name"`
+	// Base is whether the capability is in the template, or for a
+	// privileged container in every kernel capability.
+	Base bool `json:"base"`
+	// Added is whether the capability was added to the base.
+	Added bool `json:"added"`
+	// Dropped is whether the capability was dropped from the base.
+	Dropped bool `json:"dropped"`
+	// Final is whether the process keeps the capability.
+	Final bool `json:"final"`
+}
+
+// AuditCapabilities returns the decision for each capability in base or
+// final, sorted by name and named in the given style.
+func AuditCapabilities(base, final []string, style string) ([]CapabilityAudit, error) {
+	inBase, inFinal, all := map[string]bool{}, map[string]bool{}, map[string]bool{}
+	for _, c := range base {
+		inBase[capabilityKey(c)] = true
+		all[capabilityKey(c)] = true
+	}
+	for _, c := range final {
+		inFinal[capabilityKey(c)] = true
+		all[capabilityKey(c)] = true
+	}
+	var keys []string
+	for k := range all {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	names, err := StyleCapabilities(keys, style)
+	if err != nil {
+		return nil, err
+	}
+	audit := make([]CapabilityAudit, len(keys))
+	for i, k := range keys {
+		audit[i] = CapabilityAudit{
+			Name:    names[i],
+			Base:    inBase[k],
+			Added:   !inBase[k] && inFinal[k],
+			Dropped: inBase[k] && !inFinal[k],
+			Final:   inFinal[k],
+		}
+	}
+	return audit, nil
+}
+
+// capabilitiesDerivation returns a note on how the capabilities were derived,
+// the base set of n capabilities plus the adds minus the drops.
+func capabilitiesDerivation(n int, privileged bool, adds, drops []string) string {
+	base := fmt.Sprintf("template (%d capabilities)", n)
+	if privileged {
+		base = fmt.Sprintf("privileged, all kernel capabilities (%d)", n)
+	}
+	note := base
+	if len(adds) > 0 {
+		note += " + cap-add " + strings.Join(adds, ", ")
+	}
+	if len(drops) > 0 {
+		note += " - cap-drop " + strings.Join(drops, ", ")
+	}
+	return note
+}
+
+// NoteCapabilities appends the capabilities step added to or removed from the
+// process, which had the capabilities before, to the derivation note. Without
+// a note it does nothing.
+func NoteCapabilities(config *specs.Spec, step string, before []string) {
+	note, ok := config.Annotations[AnnotationCapabilitiesDerivation]
+	if !ok {
+		return
+	}
+	_, added := filterCapabilities(config.Process.Capabilities, before)
+	_, removed := filterCapabilities(before, config.Process.Capabilities)
+	if len(added) > 0 {
+		note += " + " + step + " " + strings.Join(added, ", ")
+	}
+	if len(removed) > 0 {
+		note += " - " + step + " " + strings.Join(removed, ", ")
+	}
+	setAnnotation(config, AnnotationCapabilitiesDerivation, note)
+}
+
+// AddCapabilities adds the capabilities in add that are not in caps yet to
+// caps, named in the given style, logging each one it adds with the reason.
+func AddCapabilities(caps, add []string, style, reason string) ([]string, error) {
+	if err := checkCapabilities(add); err != nil {
+		return nil, err
+	}
+	_, missing := filterCapabilities(add, caps)
+	if len(missing) == 0 {
+		return caps, nil
+	}
+	for _, c := range missing {
+		logrus.Infof("Adding capability %s, %s", c, reason)
+	}
+	names, err := StyleCapabilities(missing, style)
+	if err != nil {
+		return nil, err
+	}
+	return append(caps, names...), nil
+}
+
+// checkCapabilities returns an error for the names in caps that are not
+// capabilities the kernel knows about, in either style.
+func checkCapabilities(caps []string) error {
+	var unknown []string
+	for _, c := range caps {
+		if _, ok := prefixedNames[capabilityKey(c)]; !ok {
+			unknown = append(unknown, c)
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown capabilities %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// StyleCapabilities names caps in the given style, CapabilityStylePrefixed
+// if style is empty.
+func StyleCapabilities(caps []string, style string) ([]string, error) {
+	var prefix string
+	switch style {
+	case "", CapabilityStylePrefixed:
+		prefix = "CAP_"
+	case CapabilityStyleShort:
+	default:
+		return nil, fmt.Errorf("unknown capability name style %q, try %q or %q", style, CapabilityStylePrefixed, CapabilityStyleShort)
+	}
+
+	out := make([]string, len(caps))
+	for i, c := range caps {
+		key := capabilityKey(c)
+		if name, ok := prefixedNames[key]; ok && prefix != "" {
+			out[i] = name
+			continue
+		}
+		out[i] = prefix + key
+	}
+	return out, nil
+}
+
+// capabilityKey returns the upper case capability name without the CAP_ prefix.
+func capabilityKey(c string) string {
+	return strings.TrimPrefix(strings.ToUpper(c), "CAP_")
+}
@@ -0,0 +1,228 @@
+package parse
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/opencontainers/specs/specs-go"
+)
+
+func TestIntersectCapabilities(t *testing.T) {
+	caps := []string{"CAP_CHOWN", "CAP_AUDIT_READ", "CAP_NET_RAW", "CAP_BLOCK_SUSPEND"}
+	supported := []string{"chown", "NET_RAW", "CAP_SETUID"}
+
+	expected := []string{"CAP_CHOWN", "CAP_NET_RAW"}
+	got := IntersectCapabilities(caps, supported)
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, got)
+	}
+}
+
+func TestCapabilityPolicy(t *testing.T) {
+	f, err := ioutil.TempFile("", "riddler-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(`{"allowed": ["CHOWN", "CAP_KILL", "setuid"]}`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	policy, err := LoadCapabilityPolicy(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caps := []string{"CAP_CHOWN", "CAP_NET_RAW", "CAP_KILL", "CAP_SYS_ADMIN"}
+	got, err := policy.Apply(caps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"CAP_CHOWN", "CAP_KILL"}
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, got)
+	}
+
+	policy.Reject = true
+	if _, err := policy.Apply(caps); err == nil {
+		t.Fatal("expected error for capabilities outside the policy")
+	}
+}
+
+func TestStyleCapabilities(t *testing.T) {
+	caps := []string{"CHOWN", "CAP_KILL", "net_raw"}
+
+	styles := map[string][]string{
+		"":                      {"CAP_CHOWN", "CAP_KILL", "CAP_NET_RAW"},
+		CapabilityStylePrefixed: {"CAP_CHOWN", "CAP_KILL", "CAP_NET_RAW"},
+		CapabilityStyleShort:    {"CHOWN", "KILL", "NET_RAW"},
+	}
+	for style, expected := range styles {
+		got, err := StyleCapabilities(caps, style)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(expected, got) {
+			t.Fatalf("expected for style %q:\n%#v\ngot:\n%#v", style, expected, got)
+		}
+	}
+
+	if _, err := StyleCapabilities(caps, "lower"); err == nil {
+		t.Fatal("expected error for unknown capability name style")
+	}
+}
+
+func TestSetAmbientCapabilities(t *testing.T) {
+	config := &specs.Spec{
+		Process: specs.Process{
+			Capabilities: []string{"CAP_CHOWN", "CAP_NET_BIND_SERVICE", "CAP_SETUID"},
+		},
+	}
+
+	if err := SetAmbientCapabilities(config, []string{"net_bind_service", "CAP_CHOWN"}, CapabilityStylePrefixed); err != nil {
+		t.Fatal(err)
+	}
+	expected := "CAP_NET_BIND_SERVICE,CAP_CHOWN"
+	if ambient := config.Annotations[AnnotationAmbientCapabilities]; ambient != expected {
+		t.Fatalf("expected ambient capabilities %q, got %q", expected, ambient)
+	}
+
+	if err := SetAmbientCapabilities(config, []string{"SYS_ADMIN"}, CapabilityStylePrefixed); err == nil {
+		t.Fatal("expected error for an ambient capability the process does not have")
+	}
+	if err := SetAmbientCapabilities(config, []string{"NET_BIND_SERVICE", "NET_BIND_SERVCE"}, CapabilityStylePrefixed); err == nil || !strings.Contains(err.Error(), "NET_BIND_SERVCE") {
+		t.Fatalf("expected error for an unknown ambient capability, got: %v", err)
+	}
+}
+
+func TestAddCapabilities(t *testing.T) {
+	caps, err := AddCapabilities([]string{"CAP_CHOWN"}, []string{"chown", "NET_ADMIN"}, CapabilityStylePrefixed, "testing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"CAP_CHOWN", "CAP_NET_ADMIN"}
+	if !reflect.DeepEqual(expected, caps) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, caps)
+	}
+
+	if _, err := AddCapabilities(caps, []string{"NET_ADMN"}, CapabilityStylePrefixed, "testing"); err == nil || !strings.Contains(err.Error(), "NET_ADMN") {
+		t.Fatalf("expected error for an unknown capability, got: %v", err)
+	}
+}
+
+func TestClearCapabilities(t *testing.T) {
+	c := testContainer()
+	c.HostConfig.Privileged = true
+
+	config, err := Config(c, "linux", "amd64", []string{"CHOWN", "SYS_ADMIN"}, 0, 0, Options{EmitCapabilitiesComment: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ClearCapabilities(config)
+
+	if config.Process.Capabilities == nil || len(config.Process.Capabilities) != 0 {
+		t.Fatalf("expected empty capabilities, got %#v", config.Process.Capabilities)
+	}
+	if _, ok := config.Annotations[AnnotationCapabilitiesDerivation]; ok {
+		t.Fatal("expected no derivation note without capabilities")
+	}
+	if err := SetAmbientCapabilities(config, []string{"CHOWN"}, CapabilityStylePrefixed); err == nil {
+		t.Fatal("expected error for an ambient capability without capabilities")
+	}
+}
+
+func TestAuditCapabilities(t *testing.T) {
+	base := []string{"CHOWN", "MKNOD", "SETUID"}
+	final := []string{"CAP_SETUID", "CAP_CHOWN", "CAP_NET_ADMIN"}
+
+	audit, err := AuditCapabilities(base, final, CapabilityStylePrefixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []CapabilityAudit{
+		{Name: "CAP_CHOWN", Base: true, Final: true},
+		{Name: "CAP_MKNOD", Base: true, Dropped: true},
+		{Name: "CAP_NET_ADMIN", Added: true, Final: true},
+		{Name: "CAP_SETUID", Base: true, Final: true},
+	}
+	if !reflect.DeepEqual(expected, audit) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, audit)
+	}
+
+	data, err := json.Marshal(audit[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := `{"name":"CAP_MKNOD","base":true,"added":false,"dropped":true,"final":false}`; string(data) != s {
+		t.Fatalf("expected:\n%s\ngot:\n%s", s, data)
+	}
+}
+
+func TestConfigCapabilitiesComment(t *testing.T) {
+	c := testContainer()
+	c.HostConfig.CapAdd = []string{"NET_ADMIN"}
+	c.HostConfig.CapDrop = []string{"MKNOD", "CHOWN"}
+	caps := []string{"CHOWN", "MKNOD", "SETUID"}
+
+	config, err := Config(c, "linux", "amd64", caps, 0, 0, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.Annotations[AnnotationCapabilitiesDerivation]; ok {
+		t.Fatal("expected no derivation note without the option")
+	}
+
+	config, err = Config(c, "linux", "amd64", caps, 0, 0, Options{EmitCapabilitiesComment: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "template (3 capabilities) + cap-add NET_ADMIN - cap-drop MKNOD, CHOWN"
+	if note := config.Annotations[AnnotationCapabilitiesDerivation]; note != expected {
+		t.Fatalf("expected derivation note %q, got %q", expected, note)
+	}
+
+	// the steps after the conversion are appended to the note
+	before := config.Process.Capabilities
+	config.Process.Capabilities = []string{"CAP_NET_ADMIN", "CAP_SETUID", "CAP_SYS_PTRACE"}
+	NoteCapabilities(config, "syscalls", before)
+	before = config.Process.Capabilities
+	NoteCapabilities(config, "policy", before)
+	config.Process.Capabilities = []string{"CAP_SETUID"}
+	NoteCapabilities(config, "kernel", before)
+	expected += " + syscalls CAP_SYS_PTRACE - kernel CAP_NET_ADMIN, CAP_SYS_PTRACE"
+	if note := config.Annotations[AnnotationCapabilitiesDerivation]; note != expected {
+		t.Fatalf("expected derivation note %q, got %q", expected, note)
+	}
+}
+
+func TestWarnDangerousCapabilities(t *testing.T) {
+	var buf bytes.Buffer
+	logrus.SetOutput(&buf)
+	defer logrus.SetOutput(os.Stderr)
+
+	caps := []string{"CAP_CHOWN", "CAP_SYS_ADMIN", "CAP_NET_ADMIN"}
+
+	WarnDangerousCapabilities(caps, false, true)
+	if warnings := buf.String(); !strings.Contains(warnings, "CAP_SYS_ADMIN") || !strings.Contains(warnings, "CAP_NET_ADMIN") || strings.Contains(warnings, "CAP_CHOWN") {
+		t.Fatalf("expected warnings for CAP_SYS_ADMIN and CAP_NET_ADMIN only, got:\n%s", warnings)
+	}
+
+	buf.Reset()
+	WarnDangerousCapabilities(caps, true, false)
+	if warnings := buf.String(); !strings.Contains(warnings, "CAP_SYS_ADMIN") {
+		t.Fatalf("expected per capability warnings for a privileged container, got:\n%s", warnings)
+	}
+
+	buf.Reset()
+	WarnDangerousCapabilities(caps, true, true)
+	if warnings := buf.String(); strings.Contains(warnings, "CAP_SYS_ADMIN") || strings.Contains(warnings, "CAP_NET_ADMIN") {
+		t.Fatalf("expected no per capability warnings for a privileged container, got:\n%s", warnings)
+	}
+}
@@ -0,0 +1,69 @@
+package parse
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/opencontainers/specs/specs-go"
+)
+
+const (
+	// CgroupDriverCgroupfs manages cgroups through the cgroup filesystem, the
+	// cgroups path is a directory under the cgroup mounts.
+	CgroupDriverCgroupfs = "cgroupfs"
+	// CgroupDriverSystemd manages cgroups through systemd, the cgroups path is
+	// slice:prefix:name.
+	CgroupDriverSystemd = "systemd"
+
+	// defaultSystemdSlice is the slice docker puts containers in with the
+	// systemd cgroup driver when they have no cgroup parent.
+	defaultSystemdSlice = "system.slice"
+)
+
+// parseCgroupsPath sets the cgroups path of the container with the given id
+// under the cgroup parent the way docker does for the cgroup driver,
+// CgroupDriverCgroupfs if empty. With cgroupfs the path is only set if the
+// container has a cgroup parent, the runtime picks one otherwise.
+func parseCgroupsPath(config *specs.Spec, id, parent, driver string) error {
+	var p string
+	switch driver {
+	case "", CgroupDriverCgroupfs:
+		if parent == "" {
+			return nil
+		}
+		p = path.Join(parent, id)
+	case CgroupDriverSystemd:
+		if parent == "" {
+			parent = defaultSystemdSlice
+		}
+		if err := validateSlice(parent); err != nil {
+			return err
+		}
+		p = parent + ":docker:" + id
+	default:
+		return fmt.Errorf("unknown cgroup driver %q, try %q or %q", driver, CgroupDriverCgroupfs, CgroupDriverSystemd)
+	}
+	config.Linux.CgroupsPath = &p
+	return nil
+}
+
+// validateSlice returns an error if name is not a systemd slice name. Slices
+// are named after their path in the slice tree, a-b.slice is the child b of
+// a.slice, so the parts between the dashes can not be empty. -.slice is the
+// root slice.
+func validateSlice(name string) error {
+	if name == "-.slice" {
+		return nil
+	}
+	prefix := strings.TrimSuffix(name, ".slice")
+	if prefix == name || strings.Contains(name, "/") {
+		return fmt.Errorf("cgroup parent %q is not a systemd slice, with the systemd cgroup driver it has to be named like name.slice", name)
+	}
+	for _, part := range strings.Split(prefix, "-") {
+		if part == "" {
+			return fmt.Errorf("cgroup parent %q is not a valid systemd slice, the parts between the dashes can not be empty", name)
+		}
+	}
+	return nil
+}
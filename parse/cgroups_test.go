@@ -0,0 +1,70 @@
+package parse
+
+import (
+	"testing"
+)
+
+type cgroupsPath struct {
+	parent   string
+	driver   string
+	expected string
+}
+
+func TestConfigCgroupsPath(t *testing.T) {
+	c := testContainer()
+	id := c.ID
+
+	tests := []cgroupsPath{
+		{parent: "", driver: "", expected: ""},
+		{parent: "/custom", driver: CgroupDriverCgroupfs, expected: "/custom/" + id},
+		{parent: "", driver: CgroupDriverSystemd, expected: "system.slice:docker:" + id},
+		{parent: "machine-web.slice", driver: CgroupDriverSystemd, expected: "machine-web.slice:docker:" + id},
+		{parent: "-.slice", driver: CgroupDriverSystemd, expected: "-.slice:docker:" + id},
+	}
+
+	for _, test := range tests {
+		c.HostConfig.CgroupParent = test.parent
+		config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{CgroupDriver: test.driver})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got string
+		if config.Linux.CgroupsPath != nil {
+			got = *config.Linux.CgroupsPath
+		}
+		if got != test.expected {
+			t.Fatalf("expected cgroups path %q for %q with %q, got %q", test.expected, test.parent, test.driver, got)
+		}
+	}
+}
+
+func TestConfigCgroupsPathDaemonDriver(t *testing.T) {
+	c := testContainer()
+	c.HostConfig.CgroupParent = "web.slice"
+
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{Daemon: &DaemonInfo{CgroupDriver: CgroupDriverSystemd}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "web.slice:docker:" + c.ID
+	if config.Linux.CgroupsPath == nil || *config.Linux.CgroupsPath != expected {
+		t.Fatalf("expected cgroups path %q from the daemon cgroup driver, got %v", expected, config.Linux.CgroupsPath)
+	}
+}
+
+func TestConfigCgroupsPathInvalidSlice(t *testing.T) {
+	c := testContainer()
+
+	for _, parent := range []string{"/docker", "web", "system.slice/web.slice", "a--b.slice", "-web.slice", ".slice"} {
+		c.HostConfig.CgroupParent = parent
+		if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{CgroupDriver: CgroupDriverSystemd}); err == nil {
+			t.Fatalf("expected error for the systemd cgroup parent %q", parent)
+		}
+	}
+
+	c.HostConfig.CgroupParent = ""
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{CgroupDriver: "lxc"}); err == nil {
+		t.Fatal("expected error for an unknown cgroup driver")
+	}
+}
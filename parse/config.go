@@ -7,7 +7,6 @@ import (
 	"github.com/Sirupsen/logrus"
 	"github.com/docker/docker/daemon/execdriver"
 	"github.com/docker/engine-api/types"
-	"github.com/opencontainers/runc/libcontainer/user"
 	"github.com/opencontainers/specs/specs-go"
 )
 
@@ -29,6 +28,25 @@ const (
 	DefaultUserNSHostID = 886432
 	// DefaultUserNSMapSize is the default size for the uid and gid mappings for userns.
 	DefaultUserNSMapSize = 46578392
+
+	// DefaultCPUPeriod is the cfs period docker uses to enforce --cpus.
+	DefaultCPUPeriod = 100000
+
+	// MinOOMScoreAdj and MaxOOMScoreAdj are the bounds the kernel allows for
+	// oom_score_adj.
+	MinOOMScoreAdj = -1000
+	MaxOOMScoreAdj = 1000
+
+	// PersonalityLinux and PersonalityLinux32 are the execution domains a
+	// process can have.
+	PersonalityLinux   = "LINUX"
+	PersonalityLinux32 = "LINUX32"
+
+	// MinPersonalityVersion is the first spec version with linux.personality.
+	MinPersonalityVersion = "1.0.2"
+
+	// MinIdmapMountsVersion is the first spec version with idmapped mounts.
+	MinIdmapMountsVersion = "1.1.0"
 )
 
 var (
@@ -101,8 +119,81 @@ var (
 	}
 )
 
+// Options holds the optional settings for converting a container.
+type Options struct {
+	// Extra is the inspect data the vendored engine-api types do not decode.
+	Extra InspectExtra
+
+	// Daemon is the info of the daemon the container runs on, the security
+	// features it has enabled decide which default profiles are set. If nil
+	// every feature is assumed to be enabled.
+	Daemon *DaemonInfo
+
+	// OmitRootPath leaves Root.Path empty for bundles whose rootfs is set
+	// by the bundle manager.
+	OmitRootPath bool
+
+	// OmitDeprecatedFields leaves out the fields later spec versions moved,
+	// which only older runc versions read, Linux writes them where the later
+	// versions have them instead.
+	OmitDeprecatedFields bool
+
+	// StripAdditionalGids leaves the process without supplementary groups.
+	StripAdditionalGids bool
+
+	// CapabilityNameStyle is how capabilities are named, CapabilityStylePrefixed
+	// if empty.
+	CapabilityNameStyle string
+
+	// IdmapMounts maps the ownership of bind mounts into the user namespace,
+	// which needs spec version MinIdmapMountsVersion.
+	IdmapMounts bool
+
+	// ValidateUserExists makes a user or group name that is not in the passwd
+	// or group file an error instead of a warning.
+	ValidateUserExists bool
+
+	// ValidateRlimits makes a ulimit docker does not know an error instead of
+	// a warning.
+	ValidateRlimits bool
+
+	// UserRoot is the root of the container filesystem, user and group names
+	// are looked up in its passwd and group files. The host files are used if
+	// it is empty.
+	UserRoot string
+
+	// DefaultMountsOrder is where the default mounts go relative to the
+	// mounts of the container, DefaultMountsLast if empty.
+	DefaultMountsOrder string
+
+	// EmitCapabilitiesComment records how the capabilities were derived as
+	// an annotation.
+	EmitCapabilitiesComment bool
+
+	// SelinuxLabel overrides the selinux label of the process from the
+	// security opts.
+	SelinuxLabel string
+
+	// StrictMounts makes mounts of a type riddler does not know an error
+	// instead of converting them to bind mounts.
+	StrictMounts bool
+
+	// Personality is the execution domain of the process, PersonalityLinux or
+	// PersonalityLinux32, which needs spec version MinPersonalityVersion. It
+	// is left unset if empty.
+	Personality string
+
+	// CgroupDriver is how the cgroups of the container are managed,
+	// CgroupDriverCgroupfs or CgroupDriverSystemd. If empty the cgroup driver
+	// of the daemon is used.
+	CgroupDriver string
+
+	// SpecVersion is the version of the spec, SpecVersion if empty.
+	SpecVersion string
+}
+
 // Config takes ContainerJSON and converts it into the opencontainers spec.
-func Config(c types.ContainerJSON, osType, architecture string, capabilities []string, idroot, idlen uint32) (config *specs.Spec, err error) {
+func Config(c types.ContainerJSON, osType, architecture string, capabilities []string, idroot, idlen uint32, opts Options) (config *specs.Spec, err error) {
 	// for user namespaces use defaults unless another range specified
 	if idroot == 0 {
 		idroot = DefaultUserNSHostID
@@ -110,8 +201,18 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 	if idlen == 0 {
 		idlen = DefaultUserNSMapSize
 	}
+
+	// the kernel refuses anything else, so the inspect data is broken
+	if adj := c.HostConfig.OomScoreAdj; adj < MinOOMScoreAdj || adj > MaxOOMScoreAdj {
+		return nil, fmt.Errorf("oom score adj %d is out of the range %d to %d", adj, MinOOMScoreAdj, MaxOOMScoreAdj)
+	}
+
+	version := opts.SpecVersion
+	if version == "" {
+		version = SpecVersion
+	}
 	config = &specs.Spec{
-		Version: SpecVersion,
+		Version: version,
 		Platform: specs.Platform{
 			OS:   osType,
 			Arch: architecture,
@@ -121,10 +222,9 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 			User:     specs.User{
 			// TODO: user stuffs
 			},
-			Args: append([]string{c.Path}, c.Args...),
+			Args: processArgs(c),
 			Env:  c.Config.Env,
 			Cwd:  c.Config.WorkingDir,
-			// TODO: add parsing of Ulimits
 			Rlimits: []specs.Rlimit{
 				{
 					Type: "RLIMIT_NOFILE",
@@ -139,7 +239,7 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 			Path:     "rootfs",
 			Readonly: c.HostConfig.ReadonlyRootfs,
 		},
-		Mounts: []specs.Mount{},
+		Mounts: make([]specs.Mount, 0, len(c.Mounts)+len(DefaultMounts)+len(NetworkMounts)),
 		Linux: specs.Linux{
 			Namespaces: []specs.Namespace{
 				{
@@ -201,37 +301,40 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 		},
 	}
 
+	if opts.OmitRootPath {
+		logrus.Warn("Leaving root.path empty, runc requires it to be set before the bundle is run")
+		config.Root.Path = ""
+	}
+
 	// make sure the current working directory is not blank
 	if config.Process.Cwd == "" {
 		config.Process.Cwd = DefaultCurrentWorkingDirectory
 	}
 
 	// get the user
-	if c.Config.User != "" {
-		u, err := user.LookupUser(c.Config.User)
-		if err != nil {
-			config.Process.User = specs.User{
-				UID: uint32(u.Uid),
-				GID: uint32(u.Gid),
-			}
-		} else {
-			//return nil, fmt.Errorf("Looking up user (%s) failed: %v", c.Config.User, err)
-			logrus.Warnf("Looking up user (%s) failed: %v", c.Config.User, err)
-		}
+	if err := parseUser(config, c.Config.User, opts.UserRoot, opts.ValidateUserExists); err != nil {
+		return nil, err
 	}
 	// add the additional groups
-	for _, group := range c.HostConfig.GroupAdd {
-		g, err := user.LookupGroup(group)
-		if err != nil {
-			return nil, fmt.Errorf("Looking up group (%s) failed: %v", group, err)
+	if !opts.StripAdditionalGids {
+		for _, group := range c.HostConfig.GroupAdd {
+			g, err := lookupGroup(opts.UserRoot, group)
+			if err != nil {
+				return nil, fmt.Errorf("Looking up group (%s) failed: %v", group, err)
+			}
+			config.Process.User.AdditionalGids = append(config.Process.User.AdditionalGids, uint32(g.Gid))
 		}
-		config.Process.User.AdditionalGids = append(config.Process.User.AdditionalGids, uint32(g.Gid))
 	}
 
-	// get the hostname, if the hostname is the name as the first 12 characters of the id,
-	// then set the hostname as the container name
-	if c.ID[:12] == c.Config.Hostname {
-		config.Hostname = strings.TrimPrefix(c.Name, "/")
+	// get the hostname the container sees, docker generates it from the first
+	// 12 characters of the id when none is set
+	config.Hostname = c.Config.Hostname
+	if config.Hostname == "" {
+		id := c.ID
+		if len(id) > 12 {
+			id = id[:12]
+		}
+		config.Hostname = id
 	}
 
 	// set privileged
@@ -240,18 +343,26 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 		capabilities = execdriver.GetAllCapabilities()
 	}
 
-	// get the capabilities
-	config.Process.Capabilities, err = execdriver.TweakCapabilities(capabilities, c.HostConfig.CapAdd, c.HostConfig.CapDrop)
-	if err != nil {
-		return nil, fmt.Errorf("setting capabilities failed: %v", err)
+	// get the capabilities, most containers do not add or drop any so skip
+	// the case insensitive lookups of TweakCapabilities for them, naming the
+	// capabilities below copies the slice anyway
+	config.Process.Capabilities = capabilities
+	if len(c.HostConfig.CapAdd) > 0 || len(c.HostConfig.CapDrop) > 0 {
+		config.Process.Capabilities, err = execdriver.TweakCapabilities(capabilities, c.HostConfig.CapAdd, c.HostConfig.CapDrop)
+		if err != nil {
+			return nil, fmt.Errorf("setting capabilities failed: %v", err)
+		}
 	}
 
-	// add CAP_ prefix
-	// TODO: this is awful
-	for i, cap := range config.Process.Capabilities {
-		if !strings.HasPrefix(cap, "CAP_") {
-			config.Process.Capabilities[i] = fmt.Sprintf("CAP_%s", cap)
-		}
+	// explain where the capabilities came from, for audits
+	if opts.EmitCapabilitiesComment {
+		setAnnotation(config, AnnotationCapabilitiesDerivation, capabilitiesDerivation(len(capabilities), c.HostConfig.Privileged, c.HostConfig.CapAdd, c.HostConfig.CapDrop))
+	}
+
+	// name the capabilities the way the runtime expects
+	config.Process.Capabilities, err = StyleCapabilities(config.Process.Capabilities, opts.CapabilityNameStyle)
+	if err != nil {
+		return nil, err
 	}
 
 	// if we have a container that needs a terminal but no env vars, then set
@@ -295,37 +406,96 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 		config.Linux.GIDMappings = []specs.IDMapping{}
 	}
 
-	// get mounts
+	// windows volumes come from images or configs meant for windows, they are
+	// only an error for a linux container
+	if !IsWindows(config, opts.Extra) {
+		if err := checkLinuxVolumes(c.Config.Volumes); err != nil {
+			return nil, err
+		}
+	}
+
+	// refuse mounts we do not understand rather than half converting them
+	if opts.StrictMounts {
+		if err := checkMountTypes(opts.Extra.HostConfig.Mounts); err != nil {
+			return nil, err
+		}
+	}
+
+	// index the mounts from the modern mount structure, they take precedence
+	// over the legacy RW and mode fields when both are reported
+	modernMounts := map[string]InspectMount{}
+	for _, m := range opts.Extra.HostConfig.Mounts {
+		if dest, err := cleanDestination(m.Target); err == nil {
+			modernMounts[dest] = m
+		}
+	}
+
+	// record the volumes that are created without the image data
+	if err := parseVolumesNoCopy(config, opts.Extra.HostConfig.Mounts); err != nil {
+		return nil, err
+	}
+
+	// get mounts, starting with the tmpfs mounts which newer daemons also
+	// report as mounts without a source
 	mounts := map[string]bool{}
+	if err := parseTmpfsMounts(config, opts.Extra.HostConfig.Mounts, mounts); err != nil {
+		return nil, err
+	}
 	for _, mount := range c.Mounts {
-		mounts[mount.Destination] = true
-		var opt []string
-		if mount.RW {
-			opt = append(opt, "rw")
+		dest, err := cleanDestination(mount.Destination)
+		if err != nil {
+			return nil, err
+		}
+		if mounts[dest] {
+			continue
 		}
-		if mount.Mode != "" {
-			opt = append(opt, mount.Mode)
+		mounts[dest] = true
+
+		rw := mount.RW
+		if m, ok := modernMounts[dest]; ok {
+			rw = !m.ReadOnly
+		}
+		opt := []string{"ro"}
+		if rw {
+			opt = []string{"rw"}
+		}
+		for _, mode := range strings.Split(mount.Mode, ",") {
+			if mode != "" && mode != "ro" && mode != "rw" {
+				opt = append(opt, mode)
+			}
 		}
 		opt = append(opt, []string{"rbind", "rprivate"}...)
 
 		config.Mounts = append(config.Mounts, specs.Mount{
-			Destination: mount.Destination,
+			Destination: dest,
 			Type:        "bind",
 			Source:      mount.Source,
 			Options:     opt,
 		})
 	}
 
-	// add /etc/hosts and /etc/resolv.conf if we should have networking
+	// add the binds the daemon did not report as mounts
+	if err := parseBinds(config, c.HostConfig, mounts); err != nil {
+		return nil, err
+	}
+
+	// add /etc/hosts and /etc/resolv.conf if we should have networking,
+	// without appending to DefaultMounts itself, it is shared by every call
+	defaultMounts := DefaultMounts
 	if c.HostConfig.NetworkMode != "none" && c.HostConfig.NetworkMode != "host" {
-		DefaultMounts = append(DefaultMounts, NetworkMounts...)
+		defaultMounts = append(defaultMounts[:len(defaultMounts):len(defaultMounts)], NetworkMounts...)
 	}
 
 	// if we aren't doing something crazy like mounting a default mount ourselves,
 	// the we can mount it the default way
-	for _, mount := range DefaultMounts {
-		if _, ok := mounts[mount.Destination]; !ok {
-			config.Mounts = append(config.Mounts, mount)
+	if err := addDefaultMounts(config, defaultMounts, mounts, opts.DefaultMountsOrder); err != nil {
+		return nil, err
+	}
+
+	// idmap the bind mounts into the user namespace
+	if opts.IdmapMounts {
+		if err := parseIdmapMounts(config); err != nil {
+			return nil, err
 		}
 	}
 
@@ -347,15 +517,84 @@ func Config(c types.ContainerJSON, osType, architecture string, capabilities []s
 		return nil, err
 	}
 
+	// set the sysctls
+	parseSysctls(config, c.HostConfig.Sysctls)
+
+	// set the ulimits over the default rlimits
+	if err := parseUlimits(config, c.HostConfig.Ulimits, opts.ValidateRlimits); err != nil {
+		return nil, err
+	}
+
+	// place the cgroups under the cgroup parent
+	driver := opts.CgroupDriver
+	if driver == "" && opts.Daemon != nil {
+		driver = opts.Daemon.CgroupDriver
+	}
+	if err := parseCgroupsPath(config, c.ID, c.HostConfig.CgroupParent, driver); err != nil {
+		return nil, err
+	}
+
+	// resolve --cpus against the cfs quota and period
+	parseNanoCPUs(config, opts.Extra.HostConfig.NanoCPUs)
+
+	// record the runtime, tooling needs it to pick a compatible binary
+	if opts.Extra.HostConfig.Runtime != "" {
+		setAnnotation(config, AnnotationRuntime, opts.Extra.HostConfig.Runtime)
+	}
+
+	// record the volume driver, anonymous volumes need it to be recreated
+	if c.HostConfig.VolumeDriver != "" {
+		setAnnotation(config, AnnotationVolumeDriver, c.HostConfig.VolumeDriver)
+	}
+
+	// record the network aliases
+	parseNetworkAliases(config, c.NetworkSettings)
+	parseMacAddress(config, c)
+
+	// the execution domain is written by Linux, older spec versions have no
+	// field for it and runc would run the process in the default one
+	switch opts.Personality {
+	case "":
+	case PersonalityLinux, PersonalityLinux32:
+		if compareVersions(config.Version, MinPersonalityVersion) < 0 {
+			return nil, fmt.Errorf("personality %s needs spec version %s or later, the spec is version %s", opts.Personality, MinPersonalityVersion, config.Version)
+		}
+	default:
+		return nil, fmt.Errorf("unknown personality %q, try %q or %q", opts.Personality, PersonalityLinux, PersonalityLinux32)
+	}
+
+	// record the exposed ports
+	if err := parseExposedPorts(config, c.Config.ExposedPorts); err != nil {
+		return nil, err
+	}
+
+	// record the published ports
+	if err := parsePortBindings(config, c.HostConfig.PortBindings); err != nil {
+		return nil, err
+	}
+
+	// record the restart policy
+	if err := parseRestartPolicy(config, c.HostConfig.RestartPolicy); err != nil {
+		return nil, err
+	}
+
+	// record the healthcheck
+	if err := parseHealthcheck(config, opts.Extra.Config.Healthcheck); err != nil {
+		return nil, err
+	}
+
 	// parse devices
 	if err := parseDevices(config, c.HostConfig); err != nil {
 		return nil, err
 	}
 
 	// parse security opt
-	if err := parseSecurityOpt(config, c.HostConfig); err != nil {
+	if err := parseSecurityOpt(config, c.HostConfig, opts.Daemon); err != nil {
 		return nil, err
 	}
+	if opts.SelinuxLabel != "" {
+		config.Process.SelinuxLabel = opts.SelinuxLabel
+	}
 
 	// set privileged
 	if c.HostConfig.Privileged {
@@ -0,0 +1,145 @@
+package parse
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ExpandEnv expands ${VAR} and $VAR references in the values of env against
+// the other variables defined in env. If useHost is true, references that are
+// not defined in env are looked up in the host environment. References that
+// cannot be resolved are left as is, so templated values survive.
+func ExpandEnv(env []string, useHost bool) ([]string, error) {
+	values := map[string]string{}
+	for _, e := range env {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) == 2 {
+			values[parts[0]] = parts[1]
+		}
+	}
+
+	var (
+		expanded  = map[string]string{}
+		expanding = map[string]bool{}
+		resolve   func(key string) (string, error)
+	)
+	resolve = func(key string) (string, error) {
+		if v, ok := expanded[key]; ok {
+			return v, nil
+		}
+		// guard against variables that reference themselves, directly or not
+		if expanding[key] {
+			return "", fmt.Errorf("expanding env %s failed: recursive reference", key)
+		}
+		expanding[key] = true
+		defer delete(expanding, key)
+
+		var err error
+		v := expandReferences(values[key], func(name string) (string, bool) {
+			if _, ok := values[name]; ok {
+				s, e := resolve(name)
+				if e != nil && err == nil {
+					err = e
+				}
+				return s, true
+			}
+			if useHost {
+				return os.LookupEnv(name)
+			}
+			return "", false
+		})
+		if err != nil {
+			return "", err
+		}
+		expanded[key] = v
+		return v, nil
+	}
+
+	out := make([]string, 0, len(env))
+	for _, e := range env {
+		parts := strings.SplitN(e, "=", 2)
+		if len(parts) != 2 {
+			out = append(out, e)
+			continue
+		}
+		v, err := resolve(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, fmt.Sprintf("%s=%s", parts[0], v))
+	}
+	return out, nil
+}
+
+// expandReferences replaces the ${VAR} and $VAR references in s that lookup
+// resolves. Anything else, unresolved references, a $ not followed by a name
+// or an unterminated ${, is kept as written.
+func expandReferences(s string, lookup func(name string) (string, bool)) string {
+	var out []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' || i+1 == len(s) {
+			out = append(out, s[i])
+			continue
+		}
+
+		var name string
+		end := i + 1
+		if s[end] == '{' {
+			j := strings.IndexByte(s[end:], '}')
+			if j < 0 {
+				out = append(out, s[i])
+				continue
+			}
+			name = s[end+1 : end+j]
+			end += j + 1
+			if !isEnvName(name) {
+				out = append(out, s[i:end]...)
+				i = end - 1
+				continue
+			}
+		} else {
+			for end < len(s) && isEnvNameByte(s[end], end == i+1) {
+				end++
+			}
+			name = s[i+1 : end]
+			if name == "" {
+				out = append(out, s[i])
+				continue
+			}
+		}
+
+		if v, ok := lookup(name); ok {
+			out = append(out, v...)
+		} else {
+			out = append(out, s[i:end]...)
+		}
+		i = end - 1
+	}
+	return string(out)
+}
+
+// isEnvName returns true if name is a valid environment variable name.
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isEnvNameByte(name[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// isEnvNameByte returns true if c can be part of an environment variable
+// name, names do not start with a digit.
+func isEnvNameByte(c byte, first bool) bool {
+	switch {
+	case c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		return true
+	case '0' <= c && c <= '9':
+		return !first
+	}
+	return false
+}
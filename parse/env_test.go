@@ -0,0 +1,71 @@
+package parse
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+type envExpansion struct {
+	env      []string
+	useHost  bool
+	expected []string
+}
+
+func TestExpandEnv(t *testing.T) {
+	if err := os.Setenv("RIDDLER_TEST_HOST", "fromhost"); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("RIDDLER_TEST_HOST")
+
+	tests := []envExpansion{
+		{
+			env:      []string{"HOME=/root", "CONFIG=${HOME}/.config", "CACHE=$CONFIG/cache"},
+			expected: []string{"HOME=/root", "CONFIG=/root/.config", "CACHE=/root/.config/cache"},
+		},
+		{
+			env:      []string{"DIR=${RIDDLER_TEST_HOST}/data"},
+			expected: []string{"DIR=${RIDDLER_TEST_HOST}/data"},
+		},
+		{
+			env:      []string{"DIR=${RIDDLER_TEST_HOST}/data"},
+			useHost:  true,
+			expected: []string{"DIR=fromhost/data"},
+		},
+		{
+			env:      []string{"RIDDLER_TEST_HOST=local", "DIR=${RIDDLER_TEST_HOST}/data"},
+			useHost:  true,
+			expected: []string{"RIDDLER_TEST_HOST=local", "DIR=local/data"},
+		},
+		{
+			env:      []string{"PRICE=$5", "PASS=ab$cd", "PID=$$", "TRAILING=cost$", "UNTERMINATED=${HOME", "EMPTY=${}"},
+			expected: []string{"PRICE=$5", "PASS=ab$cd", "PID=$$", "TRAILING=cost$", "UNTERMINATED=${HOME", "EMPTY=${}"},
+		},
+		{
+			env:      []string{"USER=app", "GREETING=$HOME/$USER-${USER}_$LANG"},
+			expected: []string{"USER=app", "GREETING=$HOME/app-app_$LANG"},
+		},
+	}
+
+	for _, test := range tests {
+		env, err := ExpandEnv(test.env, test.useHost)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(test.expected, env) {
+			t.Fatalf("expected:\n%#v\ngot:\n%#v", test.expected, env)
+		}
+	}
+}
+
+func TestExpandEnvRecursive(t *testing.T) {
+	for _, env := range [][]string{
+		{"A=${A}"},
+		{"A=${B}", "B=${C}", "C=$A"},
+	} {
+		if _, err := ExpandEnv(env, false); err == nil {
+			t.Fatalf("expected recursive reference error for %v", env)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/opencontainers/specs/specs-go"
+)
+
+// ExecConfig is the part of a docker exec configuration, as sent to create
+// the exec, that changes the process. The vendored engine-api types do not
+// have Env and WorkingDir, docker 1.13+ and 17.06+.
+type ExecConfig struct {
+	User       string
+	Privileged bool
+	Tty        bool
+	Env        []string
+	Cmd        []string
+	WorkingDir string
+}
+
+// LoadExecConfig reads a docker exec configuration from a JSON file.
+func LoadExecConfig(path string) (*ExecConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading exec config %s failed: %v", path, err)
+	}
+	var exec ExecConfig
+	if err := json.Unmarshal(data, &exec); err != nil {
+		return nil, fmt.Errorf("parsing exec config %s failed: %v", path, err)
+	}
+	if len(exec.Cmd) == 0 {
+		return nil, fmt.Errorf("exec config %s has no command", path)
+	}
+	return &exec, nil
+}
+
+// ApplyExecConfig overlays the exec configuration on the process of the
+// container the way docker runs an exec in it. The command replaces the
+// args, the env is added to the env of the container and a privileged exec
+// gets all the capabilities, named in the CapabilityNameStyle of opts, but
+// keeps the apparmor profile of the container. The user is looked up the way
+// Config does and keeps the supplementary groups of the container unless
+// StripAdditionalGids is set.
+func ApplyExecConfig(config *specs.Spec, exec *ExecConfig, capabilities []string, opts Options) error {
+	config.Process.Args = exec.Cmd
+	config.Process.Terminal = exec.Tty
+	config.Process.Env = mergeEnv(config.Process.Env, exec.Env)
+	if exec.WorkingDir != "" {
+		config.Process.Cwd = exec.WorkingDir
+	}
+
+	// the exec runs as its own user, not the user of the container, docker
+	// still adds the groups of --group-add to it
+	if exec.User != "" {
+		gids := config.Process.User.AdditionalGids
+		if opts.StripAdditionalGids {
+			gids = nil
+		}
+		config.Process.User = specs.User{AdditionalGids: gids}
+		if err := parseUser(config, exec.User, opts.UserRoot, opts.ValidateUserExists); err != nil {
+			return err
+		}
+	}
+
+	if exec.Privileged {
+		caps, err := StyleCapabilities(capabilities, opts.CapabilityNameStyle)
+		if err != nil {
+			return err
+		}
+		config.Process.Capabilities = caps
+	}
+	return nil
+}
+
+// mergeEnv returns env with the variables in add, which replace the
+// variables of the same name.
+func mergeEnv(env, add []string) []string {
+	index := map[string]int{}
+	merged := make([]string, len(env))
+	for i, e := range env {
+		merged[i] = e
+		index[strings.SplitN(e, "=", 2)[0]] = i
+	}
+	for _, e := range add {
+		name := strings.SplitN(e, "=", 2)[0]
+		if i, ok := index[name]; ok {
+			merged[i] = e
+			continue
+		}
+		index[name] = len(merged)
+		merged = append(merged, e)
+	}
+	return merged
+}
@@ -0,0 +1,87 @@
+package parse
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/specs/specs-go"
+)
+
+func TestApplyExecConfig(t *testing.T) {
+	c := testContainer()
+	c.Config.User = "1000:1000"
+	c.Config.Env = []string{"PATH=/usr/bin", "HOME=/home/app"}
+	c.Config.WorkingDir = "/app"
+
+	config, err := Config(c, "linux", "amd64", []string{"CHOWN"}, 0, 0, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Process.User.AdditionalGids = []uint32{29}
+	config.Process.ApparmorProfile = DefaultApparmorProfile
+
+	exec := &ExecConfig{
+		User:       "0:10",
+		Privileged: true,
+		Tty:        true,
+		Env:        []string{"HOME=/root", "DEBUG=1"},
+		Cmd:        []string{"sh", "-c", "ps aux"},
+	}
+	if err := ApplyExecConfig(config, exec, []string{"CHOWN", "SYS_ADMIN"}, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a privileged exec keeps the apparmor profile of the container
+	expected := specs.Process{
+		Terminal:        true,
+		User:            specs.User{UID: 0, GID: 10, AdditionalGids: []uint32{29}},
+		Args:            []string{"sh", "-c", "ps aux"},
+		Env:             []string{"PATH=/usr/bin", "HOME=/root", "DEBUG=1"},
+		Cwd:             "/app",
+		Capabilities:    []string{"CAP_CHOWN", "CAP_SYS_ADMIN"},
+		ApparmorProfile: DefaultApparmorProfile,
+	}
+	process := config.Process
+	process.SelinuxLabel, process.NoNewPrivileges, process.Rlimits = "", false, nil
+	if !reflect.DeepEqual(expected, process) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, process)
+	}
+
+	// stripping the supplementary groups applies to the exec too
+	if err := ApplyExecConfig(config, exec, nil, Options{StripAdditionalGids: true}); err != nil {
+		t.Fatal(err)
+	}
+	if config.Process.User.AdditionalGids != nil {
+		t.Fatalf("expected no supplementary groups, got %v", config.Process.User.AdditionalGids)
+	}
+}
+
+func TestLoadExecConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "riddler-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(`{"User": "app", "Tty": true, "Cmd": ["bash"], "WorkingDir": "/tmp"}`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	exec, err := LoadExecConfig(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &ExecConfig{User: "app", Tty: true, Cmd: []string{"bash"}, WorkingDir: "/tmp"}
+	if !reflect.DeepEqual(expected, exec) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, exec)
+	}
+
+	if err := ioutil.WriteFile(f.Name(), []byte(`{"User": "app"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadExecConfig(f.Name()); err == nil {
+		t.Fatal("expected error for an exec config without a command")
+	}
+}
@@ -0,0 +1,130 @@
+package parse
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// InspectExtra holds the parts of the container inspect output that newer
+// docker daemons report but the vendored engine-api types do not know about.
+type InspectExtra struct {
+	// Platform is the operating system of the container, docker 17.06+.
+	Platform string
+
+	Config struct {
+		// Healthcheck is the healthcheck of the container, docker 1.12+.
+		Healthcheck *InspectHealthcheck
+	}
+
+	HostConfig struct {
+		// Mounts are the mounts from --mount, docker 1.13+.
+		Mounts []InspectMount
+		// NanoCPUs is the cpu limit from --cpus in units of 1e-9 cpus, docker 1.13+.
+		NanoCPUs int64 `json:"NanoCpus"`
+		// Runtime is the OCI runtime the daemon runs the container with, docker 1.12+.
+		Runtime string
+	}
+}
+
+// InspectMount is a mount from the HostConfig.Mounts of newer docker daemons.
+type InspectMount struct {
+	Type     string
+	Source   string
+	Target   string
+	ReadOnly bool
+
+	// TmpfsOptions are the options of tmpfs mounts.
+	TmpfsOptions *InspectTmpfsOptions
+	// VolumeOptions are the options of volume mounts.
+	VolumeOptions *InspectVolumeOptions
+}
+
+// InspectVolumeOptions are the options of a volume mount.
+type InspectVolumeOptions struct {
+	// NoCopy skips copying the image data at the target into a new volume.
+	NoCopy bool
+}
+
+// InspectTmpfsOptions are the size and mode of a tmpfs mount.
+type InspectTmpfsOptions struct {
+	SizeBytes int64
+	Mode      os.FileMode
+}
+
+// InspectHealthcheck is the healthcheck of a container.
+type InspectHealthcheck struct {
+	// Test is the check to run, prefixed with NONE, CMD or CMD-SHELL.
+	Test []string
+}
+
+// ParseInspectExtra decodes the fields of InspectExtra from the raw container
+// inspect JSON.
+func ParseInspectExtra(raw []byte) (extra InspectExtra, err error) {
+	if err := json.Unmarshal(raw, &extra); err != nil {
+		return extra, fmt.Errorf("decoding container inspect data failed: %v", err)
+	}
+	return extra, nil
+}
+
+// DaemonInfo holds the parts of the daemon info that the vendored engine-api
+// types do not know about.
+type DaemonInfo struct {
+	// SecurityOptions are the security features the daemon has enabled,
+	// as name=seccomp,profile=default since docker 1.13 and plain names before.
+	// Daemons with a custom default apparmor profile report it the same way,
+	// as name=apparmor,profile=my-profile.
+	SecurityOptions []string
+	// CgroupDriver is how the daemon manages cgroups, docker 1.11+.
+	CgroupDriver string
+}
+
+// ParseDaemonInfo decodes the fields of DaemonInfo from the raw daemon info JSON.
+func ParseDaemonInfo(raw []byte) (*DaemonInfo, error) {
+	var info DaemonInfo
+	if err := json.Unmarshal(raw, &info); err != nil {
+		return nil, fmt.Errorf("decoding daemon info failed: %v", err)
+	}
+	return &info, nil
+}
+
+// SecurityOption returns whether the daemon has the security feature enabled.
+// Without daemon info, or with a daemon too old to report its security
+// options, every feature is assumed to be enabled.
+func (d *DaemonInfo) SecurityOption(name string) bool {
+	if d == nil || d.SecurityOptions == nil {
+		return true
+	}
+	for _, opt := range d.SecurityOptions {
+		if opt == name {
+			return true
+		}
+		for _, kv := range strings.Split(opt, ",") {
+			if kv == "name="+name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SecurityOptionProfile returns the default profile the daemon reports for
+// the security feature, or an empty string if it reports none.
+func (d *DaemonInfo) SecurityOptionProfile(name string) string {
+	if d == nil {
+		return ""
+	}
+	for _, opt := range d.SecurityOptions {
+		kvs := strings.Split(opt, ",")
+		if kvs[0] != "name="+name {
+			continue
+		}
+		for _, kv := range kvs[1:] {
+			if strings.HasPrefix(kv, "profile=") {
+				return strings.TrimPrefix(kv, "profile=")
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,242 @@
+package parse
+
+import (
+	"strings"
+
+	"github.com/opencontainers/specs/specs-go"
+)
+
+// MinReleaseVersion is the first released spec version. Riddler writes it and
+// the later versions in their layout: capability sets, seccomp rules with a
+// list of syscall names, blockIO fields without the blkio prefix, the oom
+// fields in process and linux.resources.memory and no platform.
+const MinReleaseVersion = "1.0.0"
+
+// LinuxSpec is the spec for a linux container with the fields the vendored
+// spec types predate, at the place later spec versions have them.
+type LinuxSpec struct {
+	Version     string            `json:"ociVersion"`
+	Platform    *specs.Platform   `json:"platform,omitempty"`
+	Process     LinuxProcess      `json:"process"`
+	Root        specs.Root        `json:"root"`
+	Hostname    string            `json:"hostname,omitempty"`
+	Mounts      []LinuxMount      `json:"mounts"`
+	Hooks       specs.Hooks       `json:"hooks"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Linux       LinuxConfig       `json:"linux"`
+}
+
+// LinuxProcess is the process of a linux container, later spec versions
+// moved the oom score adj here from linux.resources. Capabilities are the
+// single list of the process, or LinuxCapabilities for released versions.
+type LinuxProcess struct {
+	specs.Process
+	Capabilities interface{} `json:"capabilities,omitempty"`
+	OOMScoreAdj  *int        `json:"oomScoreAdj,omitempty"`
+}
+
+// LinuxCapabilities are the capability sets of the process.
+type LinuxCapabilities struct {
+	Bounding    []string `json:"bounding,omitempty"`
+	Effective   []string `json:"effective,omitempty"`
+	Inheritable []string `json:"inheritable,omitempty"`
+	Permitted   []string `json:"permitted,omitempty"`
+	Ambient     []string `json:"ambient,omitempty"`
+}
+
+// LinuxMount is a mount with its own uid and gid mappings, for idmapped bind
+// mounts.
+type LinuxMount struct {
+	specs.Mount
+	UIDMappings []specs.IDMapping `json:"uidMappings,omitempty"`
+	GIDMappings []specs.IDMapping `json:"gidMappings,omitempty"`
+}
+
+// LinuxConfig is the linux configuration of a linux container. Seccomp is the
+// seccomp profile of the spec, or LinuxSeccomp for released versions.
+type LinuxConfig struct {
+	specs.Linux
+	Resources   *LinuxResources   `json:"resources,omitempty"`
+	Seccomp     interface{}       `json:"seccomp,omitempty"`
+	Personality *LinuxPersonality `json:"personality,omitempty"`
+}
+
+// LinuxPersonality is the execution domain of the process.
+type LinuxPersonality struct {
+	Domain string   `json:"domain"`
+	Flags  []string `json:"flags,omitempty"`
+}
+
+// LinuxSeccomp is the seccomp profile of a released spec version.
+type LinuxSeccomp struct {
+	DefaultAction specs.Action   `json:"defaultAction"`
+	Architectures []specs.Arch   `json:"architectures,omitempty"`
+	Syscalls      []LinuxSyscall `json:"syscalls,omitempty"`
+}
+
+// LinuxSyscall is a seccomp rule for a list of syscalls.
+type LinuxSyscall struct {
+	Names  []string     `json:"names"`
+	Action specs.Action `json:"action"`
+	Args   []specs.Arg  `json:"args,omitempty"`
+}
+
+// LinuxResources are the resources of a linux container. BlockIO is the
+// blockIO of the spec, or LinuxBlockIO for released versions.
+type LinuxResources struct {
+	specs.Resources
+	Memory  *LinuxMemory `json:"memory,omitempty"`
+	BlockIO interface{}  `json:"blockIO,omitempty"`
+}
+
+// LinuxMemory is the memory of a linux container, later spec versions moved
+// the oom killer toggle here from linux.resources.
+type LinuxMemory struct {
+	specs.Memory
+	DisableOOMKiller *bool `json:"disableOOMKiller,omitempty"`
+}
+
+// LinuxBlockIO is the blockIO of a released spec version.
+type LinuxBlockIO struct {
+	Weight                  *uint16                `json:"weight,omitempty"`
+	LeafWeight              *uint16                `json:"leafWeight,omitempty"`
+	WeightDevice            []specs.WeightDevice   `json:"weightDevice,omitempty"`
+	ThrottleReadBpsDevice   []specs.ThrottleDevice `json:"throttleReadBpsDevice,omitempty"`
+	ThrottleWriteBpsDevice  []specs.ThrottleDevice `json:"throttleWriteBpsDevice,omitempty"`
+	ThrottleReadIOPSDevice  []specs.ThrottleDevice `json:"throttleReadIOPSDevice,omitempty"`
+	ThrottleWriteIOPSDevice []specs.ThrottleDevice `json:"throttleWriteIOPSDevice,omitempty"`
+}
+
+// Linux returns what is written for the spec of a linux container, the spec
+// itself unless its version or opts need fields it does not have. Omitting
+// the deprecated fields moves the oom fields to where later spec versions
+// have them instead of dropping their values, released versions always have
+// them there.
+func Linux(config *specs.Spec, opts Options) interface{} {
+	release := compareVersions(config.Version, MinReleaseVersion) >= 0
+	if !release && !opts.OmitDeprecatedFields && !opts.IdmapMounts && opts.Personality == "" {
+		return config
+	}
+
+	spec := &LinuxSpec{
+		Version:     config.Version,
+		Process:     LinuxProcess{Process: config.Process},
+		Root:        config.Root,
+		Hostname:    config.Hostname,
+		Mounts:      linuxMounts(config, opts.IdmapMounts),
+		Hooks:       config.Hooks,
+		Annotations: config.Annotations,
+		Linux:       LinuxConfig{Linux: config.Linux},
+	}
+	if !release {
+		platform := config.Platform
+		spec.Platform = &platform
+	}
+	if opts.Personality != "" {
+		spec.Linux.Personality = &LinuxPersonality{Domain: opts.Personality}
+	}
+
+	// keep omitting an empty list, the way the spec does
+	caps := config.Process.Capabilities
+	switch {
+	case release:
+		spec.Process.Capabilities = capabilitySets(config)
+	case len(caps) > 0:
+		spec.Process.Capabilities = caps
+	}
+
+	if s := config.Linux.Seccomp; s != nil {
+		spec.Linux.Seccomp = s
+		if release {
+			spec.Linux.Seccomp = linuxSeccomp(s)
+		}
+	}
+
+	if r := config.Linux.Resources; r != nil {
+		resources := &LinuxResources{Resources: *r}
+		if r.Memory != nil {
+			resources.Memory = &LinuxMemory{Memory: *r.Memory}
+		}
+		if b := r.BlockIO; b != nil {
+			resources.BlockIO = b
+			if release {
+				resources.BlockIO = &LinuxBlockIO{
+					Weight:                  b.Weight,
+					LeafWeight:              b.LeafWeight,
+					WeightDevice:            b.WeightDevice,
+					ThrottleReadBpsDevice:   b.ThrottleReadBpsDevice,
+					ThrottleWriteBpsDevice:  b.ThrottleWriteBpsDevice,
+					ThrottleReadIOPSDevice:  b.ThrottleReadIOPSDevice,
+					ThrottleWriteIOPSDevice: b.ThrottleWriteIOPSDevice,
+				}
+			}
+		}
+
+		if release || opts.OmitDeprecatedFields {
+			spec.Process.OOMScoreAdj = r.OOMScoreAdj
+			if r.DisableOOMKiller != nil {
+				if resources.Memory == nil {
+					resources.Memory = &LinuxMemory{}
+				}
+				resources.Memory.DisableOOMKiller = r.DisableOOMKiller
+			}
+		}
+		if opts.OmitDeprecatedFields {
+			resources.OOMScoreAdj = nil
+			resources.DisableOOMKiller = nil
+		}
+		spec.Linux.Resources = resources
+	}
+	return spec
+}
+
+// linuxMounts returns the mounts of the spec, if idmap is true each bind
+// mount is idmapped with the id mappings of the user namespace so the files
+// keep their ownership inside the container.
+func linuxMounts(config *specs.Spec, idmap bool) []LinuxMount {
+	mounts := make([]LinuxMount, len(config.Mounts))
+	for i, m := range config.Mounts {
+		mounts[i] = LinuxMount{Mount: m}
+		if !idmap || m.Type != "bind" || len(config.Linux.UIDMappings) == 0 {
+			continue
+		}
+		mounts[i].Options = append(append([]string{}, m.Options...), "idmap")
+		mounts[i].UIDMappings = config.Linux.UIDMappings
+		mounts[i].GIDMappings = config.Linux.GIDMappings
+	}
+	return mounts
+}
+
+// capabilitySets returns the capability sets of the process. The spec has a
+// single list, which docker gives the process as its bounding, effective,
+// inheritable and permitted set, the ambient set is in an annotation.
+func capabilitySets(config *specs.Spec) *LinuxCapabilities {
+	caps := config.Process.Capabilities
+	sets := &LinuxCapabilities{
+		Bounding:    caps,
+		Effective:   caps,
+		Inheritable: caps,
+		Permitted:   caps,
+	}
+	if ambient := config.Annotations[AnnotationAmbientCapabilities]; ambient != "" {
+		sets.Ambient = strings.Split(ambient, ",")
+	}
+	return sets
+}
+
+// linuxSeccomp returns the seccomp profile with a rule per syscall in the
+// layout of the released spec versions.
+func linuxSeccomp(s *specs.Seccomp) *LinuxSeccomp {
+	seccomp := &LinuxSeccomp{
+		DefaultAction: s.DefaultAction,
+		Architectures: s.Architectures,
+	}
+	for _, sc := range s.Syscalls {
+		seccomp.Syscalls = append(seccomp.Syscalls, LinuxSyscall{
+			Names:  []string{sc.Name},
+			Action: sc.Action,
+			Args:   sc.Args,
+		})
+	}
+	return seccomp
+}
@@ -0,0 +1,162 @@
+package parse
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/opencontainers/specs/specs-go"
+)
+
+type oomFields struct {
+	Process struct {
+		OOMScoreAdj *int `json:"oomScoreAdj"`
+	} `json:"process"`
+	Linux struct {
+		Resources struct {
+			OOMScoreAdj      *int  `json:"oomScoreAdj"`
+			DisableOOMKiller *bool `json:"disableOOMKiller"`
+			Memory           *struct {
+				DisableOOMKiller *bool `json:"disableOOMKiller"`
+			} `json:"memory"`
+		} `json:"resources"`
+	} `json:"linux"`
+}
+
+func TestLinuxOmitDeprecatedFields(t *testing.T) {
+	c := testContainer()
+	c.HostConfig.OomScoreAdj = 500
+	disable := true
+	c.HostConfig.OomKillDisable = &disable
+
+	for _, omit := range []bool{false, true} {
+		opts := Options{OmitDeprecatedFields: omit}
+		config, err := Config(c, "linux", "amd64", nil, 0, 0, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(Linux(config, opts))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out oomFields
+		if err := json.Unmarshal(data, &out); err != nil {
+			t.Fatal(err)
+		}
+
+		// the deprecated fields are there unless omitted
+		resources := out.Linux.Resources
+		if (resources.OOMScoreAdj != nil) == omit || (resources.DisableOOMKiller != nil) == omit {
+			t.Fatalf("expected the deprecated fields present to be %v with omit %v, got:\n%s", !omit, omit, data)
+		}
+		if !omit {
+			continue
+		}
+
+		// and their values are moved rather than lost
+		if out.Process.OOMScoreAdj == nil || *out.Process.OOMScoreAdj != 500 {
+			t.Fatalf("expected oomScoreAdj 500 in the process, got:\n%s", data)
+		}
+		if resources.Memory == nil || resources.Memory.DisableOOMKiller == nil || !*resources.Memory.DisableOOMKiller {
+			t.Fatalf("expected disableOOMKiller in the memory resources, got:\n%s", data)
+		}
+	}
+}
+
+func TestLinuxIdmapMounts(t *testing.T) {
+	mappings := []specs.IDMapping{{HostID: 100000, ContainerID: 0, Size: 65536}}
+	config := &specs.Spec{
+		Version: MinIdmapMountsVersion,
+		Mounts: []specs.Mount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/data", Type: "bind", Source: "/srv/data", Options: []string{"rbind", "rw"}},
+		},
+		Linux: specs.Linux{UIDMappings: mappings, GIDMappings: mappings},
+	}
+	if err := parseIdmapMounts(config); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []LinuxMount{
+		{Mount: config.Mounts[0]},
+		{
+			Mount:       specs.Mount{Destination: "/data", Type: "bind", Source: "/srv/data", Options: []string{"rbind", "rw", "idmap"}},
+			UIDMappings: mappings,
+			GIDMappings: mappings,
+		},
+	}
+	spec, ok := Linux(config, Options{IdmapMounts: true}).(*LinuxSpec)
+	if !ok {
+		t.Fatal("expected a LinuxSpec for idmapped mounts")
+	}
+	if !reflect.DeepEqual(expected, spec.Mounts) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, spec.Mounts)
+	}
+	if len(config.Mounts[1].Options) != 2 {
+		t.Fatalf("expected the options of the spec to be left alone, got %v", config.Mounts[1].Options)
+	}
+}
+
+func TestLinuxReleaseVersion(t *testing.T) {
+	c := testContainer()
+	weight := uint16(300)
+	c.HostConfig.BlkioWeight = weight
+	c.HostConfig.OomScoreAdj = 200
+
+	config, err := Config(c, "linux", "amd64", []string{"CHOWN", "NET_BIND_SERVICE"}, 0, 0, Options{SpecVersion: "1.1.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Linux.Seccomp = &specs.Seccomp{
+		DefaultAction: specs.ActErrno,
+		Syscalls:      []specs.Syscall{{Name: "chown", Action: specs.ActAllow}},
+	}
+	if err := SetAmbientCapabilities(config, []string{"NET_BIND_SERVICE"}, CapabilityStylePrefixed); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(Linux(config, Options{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out map[string]interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := out["platform"]; ok {
+		t.Fatalf("expected no platform in a released spec version, got:\n%s", data)
+	}
+
+	var release struct {
+		Process struct {
+			Capabilities LinuxCapabilities `json:"capabilities"`
+			OOMScoreAdj  *int              `json:"oomScoreAdj"`
+		} `json:"process"`
+		Linux struct {
+			Resources struct {
+				BlockIO struct {
+					Weight *uint16 `json:"weight"`
+				} `json:"blockIO"`
+			} `json:"resources"`
+			Seccomp LinuxSeccomp `json:"seccomp"`
+		} `json:"linux"`
+	}
+	if err := json.Unmarshal(data, &release); err != nil {
+		t.Fatal(err)
+	}
+	caps := []string{"CAP_CHOWN", "CAP_NET_BIND_SERVICE"}
+	expected := LinuxCapabilities{Bounding: caps, Effective: caps, Inheritable: caps, Permitted: caps, Ambient: []string{"CAP_NET_BIND_SERVICE"}}
+	if !reflect.DeepEqual(expected, release.Process.Capabilities) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, release.Process.Capabilities)
+	}
+	if release.Process.OOMScoreAdj == nil || *release.Process.OOMScoreAdj != 200 {
+		t.Fatalf("expected oomScoreAdj 200 in the process, got:\n%s", data)
+	}
+	if w := release.Linux.Resources.BlockIO.Weight; w == nil || *w != weight {
+		t.Fatalf("expected the blockIO weight %d, got:\n%s", weight, data)
+	}
+	syscalls := []LinuxSyscall{{Names: []string{"chown"}, Action: specs.ActAllow}}
+	if !reflect.DeepEqual(syscalls, release.Linux.Seccomp.Syscalls) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", syscalls, release.Linux.Seccomp.Syscalls)
+	}
+}
@@ -0,0 +1,276 @@
+package parse
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	containertypes "github.com/docker/engine-api/types/container"
+	"github.com/opencontainers/specs/specs-go"
+)
+
+const (
+	// DefaultMountsFirst puts the default mounts before the mounts of the
+	// container.
+	DefaultMountsFirst = "first"
+	// DefaultMountsLast puts the default mounts after the mounts of the
+	// container.
+	DefaultMountsLast = "last"
+)
+
+// sourceMountTypes are the types of the modern mount structure riddler knows
+// how to turn into spec mounts.
+var sourceMountTypes = map[string]bool{
+	"bind":   true,
+	"volume": true,
+	"tmpfs":  true,
+}
+
+// specMountTypes are the mount types runtimes know how to mount.
+var specMountTypes = map[string]bool{
+	"bind":   true,
+	"tmpfs":  true,
+	"proc":   true,
+	"sysfs":  true,
+	"cgroup": true,
+	"devpts": true,
+	"mqueue": true,
+	"shm":    true,
+}
+
+// windowsPath matches drive letter and UNC paths.
+var windowsPath = regexp.MustCompile(`^([a-zA-Z]:|\\\\)`)
+
+var propagationModes = map[string]bool{
+	"private":  true,
+	"rprivate": true,
+	"shared":   true,
+	"rshared":  true,
+	"slave":    true,
+	"rslave":   true,
+}
+
+// checkLinuxVolumes returns an error for the volumes of the container that are
+// windows paths, they can not be mounted in a linux container.
+func checkLinuxVolumes(volumes map[string]struct{}) error {
+	var windows []string
+	for v := range volumes {
+		if windowsPath.MatchString(v) {
+			windows = append(windows, v)
+		}
+	}
+	if len(windows) > 0 {
+		sort.Strings(windows)
+		return fmt.Errorf("volumes %s are windows paths, they can not be used in a linux spec", strings.Join(windows, ", "))
+	}
+	return nil
+}
+
+// checkMountTypes returns an error for the mounts of the modern mount
+// structure with a type riddler does not know, which would otherwise end up
+// as plain bind mounts of whatever the daemon reported as their source.
+func checkMountTypes(modern []InspectMount) error {
+	var unknown []string
+	for _, m := range modern {
+		if !sourceMountTypes[m.Type] {
+			unknown = append(unknown, fmt.Sprintf("%s (%s)", m.Target, m.Type))
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("mounts %s have an unsupported type", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// WarnUnknownMountTypes warns about each mount with a type runtimes may not
+// know how to mount.
+func WarnUnknownMountTypes(mounts []specs.Mount) {
+	for _, m := range mounts {
+		if !specMountTypes[m.Type] {
+			logrus.Warnf("Mount %s has type %q, runtimes may not know how to mount it", m.Destination, m.Type)
+		}
+	}
+}
+
+// parseTmpfsMounts adds the tmpfs mounts from the modern mount structure and
+// records their destinations in mounts.
+func parseTmpfsMounts(config *specs.Spec, modern []InspectMount, mounts map[string]bool) error {
+	for _, m := range modern {
+		if m.Type != "tmpfs" {
+			continue
+		}
+		dest, err := cleanDestination(m.Target)
+		if err != nil {
+			return err
+		}
+		mounts[dest] = true
+		config.Mounts = append(config.Mounts, specs.Mount{
+			Destination: dest,
+			Type:        "tmpfs",
+			Source:      "tmpfs",
+			Options:     tmpfsOptions(m),
+		})
+	}
+	return nil
+}
+
+// parseVolumesNoCopy records the destinations of the volume mounts from the
+// modern mount structure with nocopy, the spec has no way to say a volume
+// should be created empty.
+func parseVolumesNoCopy(config *specs.Spec, modern []InspectMount) error {
+	var nocopy []string
+	for _, m := range modern {
+		if m.Type != "volume" || m.VolumeOptions == nil || !m.VolumeOptions.NoCopy {
+			continue
+		}
+		dest, err := cleanDestination(m.Target)
+		if err != nil {
+			return err
+		}
+		nocopy = append(nocopy, dest)
+	}
+	if len(nocopy) > 0 {
+		setAnnotation(config, AnnotationVolumesNoCopy, strings.Join(nocopy, ","))
+	}
+	return nil
+}
+
+// tmpfsOptions returns the mount options for a tmpfs mount the way docker
+// sets them, with the size in the largest whole unit and the mode in octal.
+func tmpfsOptions(m InspectMount) []string {
+	opt := []string{"rw"}
+	if m.ReadOnly {
+		opt[0] = "ro"
+	}
+	opt = append(opt, "nosuid", "nodev", "noexec")
+	if m.TmpfsOptions == nil {
+		return opt
+	}
+
+	if size := m.TmpfsOptions.SizeBytes; size > 0 {
+		suffix := ""
+		for _, unit := range []string{"k", "m", "g"} {
+			if size%1024 != 0 {
+				break
+			}
+			size /= 1024
+			suffix = unit
+		}
+		opt = append(opt, fmt.Sprintf("size=%d%s", size, suffix))
+	}
+	if mode := m.TmpfsOptions.Mode; mode != 0 {
+		opt = append(opt, fmt.Sprintf("mode=%o", mode))
+	}
+	return opt
+}
+
+// parseBinds adds the binds from the host config that are not already in
+// mounts, which holds the destinations that have been mounted so far.
+func parseBinds(config *specs.Spec, hc *containertypes.HostConfig, mounts map[string]bool) error {
+	for _, bind := range hc.Binds {
+		parts := strings.Split(bind, ":")
+		if len(parts) < 2 || len(parts) > 3 {
+			return fmt.Errorf("invalid bind %q", bind)
+		}
+
+		dest, err := cleanDestination(parts[1])
+		if err != nil {
+			return err
+		}
+		if mounts[dest] {
+			continue
+		}
+
+		// named volumes are resolved by the daemon, we can't know the source
+		if !path.IsAbs(parts[0]) {
+			logrus.Warnf("Skipping bind %s, source is not a host path", bind)
+			continue
+		}
+
+		var mode []string
+		if len(parts) == 3 {
+			mode = strings.Split(parts[2], ",")
+		}
+		opt := []string{"rw"}
+		propagation := "rprivate"
+		for _, m := range mode {
+			switch {
+			case m == "ro":
+				opt[0] = "ro"
+			case propagationModes[m]:
+				propagation = m
+			}
+		}
+		opt = append(opt, "rbind", propagation)
+
+		mounts[dest] = true
+		config.Mounts = append(config.Mounts, specs.Mount{
+			Destination: dest,
+			Type:        "bind",
+			Source:      parts[0],
+			Options:     opt,
+		})
+	}
+
+	return nil
+}
+
+// addDefaultMounts adds the default mounts that are not already in mounts,
+// which holds the destinations of the mounts of the container, before or
+// after them depending on order. Runtimes mount in spec order, so for some of
+// them it matters whether /proc and /dev come first.
+func addDefaultMounts(config *specs.Spec, defaults []specs.Mount, mounts map[string]bool, order string) error {
+	var add []specs.Mount
+	for _, mount := range defaults {
+		if !mounts[mount.Destination] {
+			add = append(add, mount)
+		}
+	}
+
+	switch order {
+	case "", DefaultMountsLast:
+		config.Mounts = append(config.Mounts, add...)
+	case DefaultMountsFirst:
+		config.Mounts = append(add, config.Mounts...)
+	default:
+		return fmt.Errorf("unknown default mounts order %q, try %q or %q", order, DefaultMountsFirst, DefaultMountsLast)
+	}
+	return nil
+}
+
+// cleanDestination returns the clean absolute path for a mount destination.
+func cleanDestination(dest string) (string, error) {
+	if !path.IsAbs(dest) {
+		return "", fmt.Errorf("mount destination %q is not an absolute path", dest)
+	}
+	return path.Clean(dest), nil
+}
+
+// parseIdmapMounts checks the bind mounts of a container with a user
+// namespace can be idmapped, Linux then idmaps them in the output. The spec
+// only has per mount id mappings since MinIdmapMountsVersion, older versions
+// are an error rather than a spec that silently mounts with the wrong
+// ownership.
+func parseIdmapMounts(config *specs.Spec) error {
+	if len(config.Linux.UIDMappings) == 0 {
+		return nil
+	}
+
+	var binds []string
+	for _, m := range config.Mounts {
+		if m.Type == "bind" {
+			binds = append(binds, m.Destination)
+		}
+	}
+	if len(binds) == 0 {
+		return nil
+	}
+
+	if compareVersions(config.Version, MinIdmapMountsVersion) < 0 {
+		return fmt.Errorf("idmapped mounts for %s need spec version %s or later, the spec is version %s", strings.Join(binds, ", "), MinIdmapMountsVersion, config.Version)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package parse
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/engine-api/types"
+	containertypes "github.com/docker/engine-api/types/container"
+	"github.com/opencontainers/specs/specs-go"
+)
+
+func TestParseBinds(t *testing.T) {
+	config := &specs.Spec{}
+	hostConfig := &containertypes.HostConfig{
+		Binds: []string{"/home/user/src:/src/", "/etc/ssl:/etc/ssl/../ssl/:ro", "/var/log:/var/log"},
+	}
+	// /var/log was already reported by the daemon
+	mounts := map[string]bool{"/var/log": true}
+
+	if err := parseBinds(config, hostConfig, mounts); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []specs.Mount{
+		{
+			Destination: "/src",
+			Type:        "bind",
+			Source:      "/home/user/src",
+			Options:     []string{"rw", "rbind", "rprivate"},
+		},
+		{
+			Destination: "/etc/ssl",
+			Type:        "bind",
+			Source:      "/etc/ssl",
+			Options:     []string{"ro", "rbind", "rprivate"},
+		},
+	}
+	if !reflect.DeepEqual(expected, config.Mounts) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, config.Mounts)
+	}
+}
+
+func TestParseBindsRelativeDestination(t *testing.T) {
+	hostConfig := &containertypes.HostConfig{
+		Binds: []string{"/home/user/src:src"},
+	}
+
+	if err := parseBinds(&specs.Spec{}, hostConfig, map[string]bool{}); err == nil {
+		t.Fatal("expected error for relative bind destination")
+	}
+}
+
+func TestConfigIdmapMounts(t *testing.T) {
+	c := testContainer()
+	c.Mounts = []types.MountPoint{
+		{
+			Source:      "/srv/data",
+			Destination: "/data",
+			RW:          true,
+		},
+	}
+
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the spec version riddler generates predates idmapped mounts
+	_, err := Config(c, "linux", "amd64", nil, 0, 0, Options{IdmapMounts: true})
+	if err == nil || !strings.Contains(err.Error(), MinIdmapMountsVersion) {
+		t.Fatalf("expected spec version error for idmapped mounts, got: %v", err)
+	}
+}
+
+type defaultMountsOrder struct {
+	order    string
+	expected []string
+}
+
+func TestConfigDefaultMountsOrder(t *testing.T) {
+	c := testContainer()
+	c.HostConfig.NetworkMode = "none"
+	c.Mounts = []types.MountPoint{
+		{Source: "/srv/data", Destination: "/data", RW: true},
+	}
+
+	var defaults []string
+	for _, m := range DefaultMounts {
+		defaults = append(defaults, m.Destination)
+	}
+	tests := []defaultMountsOrder{
+		{order: "", expected: append([]string{"/data"}, defaults...)},
+		{order: DefaultMountsLast, expected: append([]string{"/data"}, defaults...)},
+		{order: DefaultMountsFirst, expected: append(defaults, "/data")},
+	}
+
+	for _, test := range tests {
+		config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{DefaultMountsOrder: test.order})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, m := range config.Mounts {
+			got = append(got, m.Destination)
+		}
+		if !reflect.DeepEqual(test.expected, got) {
+			t.Fatalf("expected:\n%#v\ngot:\n%#v", test.expected, got)
+		}
+	}
+
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{DefaultMountsOrder: "middle"}); err == nil {
+		t.Fatal("expected error for an unknown order")
+	}
+}
+
+func TestConfigTmpfsMountMode(t *testing.T) {
+	c := testContainer()
+	// newer daemons report tmpfs mounts without a source
+	c.Mounts = []types.MountPoint{
+		{Destination: "/run", RW: true},
+	}
+
+	// 1023 is 01777 and 67108864 is 64m
+	extra, err := ParseInspectExtra([]byte(`{"HostConfig": {"Mounts": [{"Type": "tmpfs", "Target": "/run", "TmpfsOptions": {"SizeBytes": 67108864, "Mode": 1023}}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{Extra: extra})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := specs.Mount{
+		Destination: "/run",
+		Type:        "tmpfs",
+		Source:      "tmpfs",
+		Options:     []string{"rw", "nosuid", "nodev", "noexec", "size=64m", "mode=1777"},
+	}
+	var found []specs.Mount
+	for _, m := range config.Mounts {
+		if m.Destination == "/run" {
+			found = append(found, m)
+		}
+	}
+	if len(found) != 1 || !reflect.DeepEqual(expected, found[0]) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, found)
+	}
+}
+
+func TestConfigVolumesNoCopy(t *testing.T) {
+	c := testContainer()
+	c.Mounts = []types.MountPoint{
+		{Name: "data", Source: "/var/lib/docker/volumes/data/_data", Destination: "/data", RW: true},
+		{Name: "cache", Source: "/var/lib/docker/volumes/cache/_data", Destination: "/cache", RW: true},
+	}
+	extra, err := ParseInspectExtra([]byte(`{"HostConfig": {"Mounts": [
+		{"Type": "volume", "Source": "data", "Target": "/data/", "VolumeOptions": {"NoCopy": true}},
+		{"Type": "volume", "Source": "cache", "Target": "/cache", "VolumeOptions": {}}
+	]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{Extra: extra})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nocopy := config.Annotations[AnnotationVolumesNoCopy]; nocopy != "/data" {
+		t.Fatalf("expected the nocopy volumes %q, got %q", "/data", nocopy)
+	}
+
+	config, err = Config(c, "linux", "amd64", nil, 0, 0, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := config.Annotations[AnnotationVolumesNoCopy]; ok {
+		t.Fatal("expected no nocopy annotation without nocopy volumes")
+	}
+}
+
+func TestConfigStrictMounts(t *testing.T) {
+	c := testContainer()
+	c.Mounts = []types.MountPoint{
+		{Source: "/run/secrets", Destination: "/secrets", RW: false},
+	}
+	extra, err := ParseInspectExtra([]byte(`{"HostConfig": {"Mounts": [{"Type": "cluster", "Target": "/secrets"}]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{Extra: extra}); err != nil {
+		t.Fatalf("expected unknown mount types to be converted without --strict-mounts, got: %v", err)
+	}
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{Extra: extra, StrictMounts: true}); err == nil {
+		t.Fatal("expected error for an unknown mount type")
+	}
+}
+
+func TestConfigWindowsVolumes(t *testing.T) {
+	c := testContainer()
+	c.Config.Volumes = map[string]struct{}{"/data": {}}
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{`C:\data`, "c:/data", `\\server\share`} {
+		c.Config.Volumes = map[string]struct{}{"/data": {}, v: {}}
+		_, err := Config(c, "linux", "amd64", nil, 0, 0, Options{})
+		if err == nil || !strings.Contains(err.Error(), v) {
+			t.Fatalf("expected error for windows volume %s, got: %v", v, err)
+		}
+	}
+
+	// the same volumes are fine for a windows container
+	c.Config.Volumes = map[string]struct{}{`C:\data`: {}, `\\server\share`: {}}
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{Extra: InspectExtra{Platform: "windows"}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWarnUnknownMountTypes(t *testing.T) {
+	var buf bytes.Buffer
+	logrus.SetOutput(&buf)
+	defer logrus.SetOutput(os.Stderr)
+
+	WarnUnknownMountTypes([]specs.Mount{
+		{Destination: "/proc", Type: "proc", Source: "proc"},
+		{Destination: "/data", Type: "bind", Source: "/srv/data"},
+		{Destination: "/mnt/nfs", Type: "nfs", Source: "server:/export"},
+	})
+	warnings := buf.String()
+	if !strings.Contains(warnings, "/mnt/nfs") || strings.Contains(warnings, "/proc") || strings.Contains(warnings, "/data") {
+		t.Fatalf("expected a warning for /mnt/nfs only, got:\n%s", warnings)
+	}
+}
@@ -0,0 +1,27 @@
+package parse
+
+import (
+	containertypes "github.com/docker/engine-api/types/container"
+	"github.com/opencontainers/specs/specs-go"
+)
+
+// HostNamespaces returns the namespaces the container shares with the host.
+func HostNamespaces(hc *containertypes.HostConfig) []specs.NamespaceType {
+	var host []specs.NamespaceType
+	if hc.NetworkMode.IsHost() {
+		host = append(host, specs.NetworkNamespace)
+	}
+	if hc.PidMode.IsHost() {
+		host = append(host, specs.PIDNamespace)
+	}
+	if hc.IpcMode.IsHost() {
+		host = append(host, specs.IPCNamespace)
+	}
+	if hc.UTSMode.IsHost() {
+		host = append(host, specs.UTSNamespace)
+	}
+	if hc.UsernsMode.IsHost() {
+		host = append(host, specs.UserNamespace)
+	}
+	return host
+}
@@ -0,0 +1,264 @@
+package parse
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/engine-api/types"
+	"github.com/docker/go-connections/nat"
+	"github.com/opencontainers/specs/specs-go"
+)
+
+// parseMacAddress records the mac address of the container.
+func parseMacAddress(config *specs.Spec, c types.ContainerJSON) {
+	if mac := macAddress(c); mac != "" {
+		setAnnotation(config, AnnotationMacAddress, mac)
+	}
+}
+
+// parseNetworkAliases records the aliases the container has on each network.
+func parseNetworkAliases(config *specs.Spec, ns *types.NetworkSettings) {
+	if ns == nil {
+		return
+	}
+	for name, ep := range ns.Networks {
+		if ep != nil && len(ep.Aliases) > 0 {
+			setAnnotation(config, AnnotationNetworkAliases(name), strings.Join(ep.Aliases, ","))
+		}
+	}
+}
+
+// NetnsHook is the name of the netns hook binary, its hooks get the address
+// of the container in their env.
+const NetnsHook = "netns"
+
+// SetNetnsHookEnv adds the address, prefix length, gateway, mac address and
+// port bindings of the container to the env of the netns hooks, so they can
+// configure the interface fully.
+func SetNetnsHookEnv(hooks *specs.Hooks, c types.ContainerJSON) {
+	env := netnsEnv(c)
+	if len(env) == 0 {
+		return
+	}
+	for _, list := range []*[]specs.Hook{&hooks.Prestart, &hooks.Poststart, &hooks.Poststop} {
+		// copy the hooks, they may be shared with the specs of other containers
+		*list = append([]specs.Hook(nil), *list...)
+		for i, h := range *list {
+			if filepath.Base(h.Path) == NetnsHook {
+				(*list)[i].Env = append(append([]string{}, h.Env...), env...)
+			}
+		}
+	}
+}
+
+// netnsEnv returns the env for the netns hooks.
+func netnsEnv(c types.ContainerJSON) []string {
+	ep := primaryEndpoint(c.NetworkSettings)
+	if ep.IPAddress == "" {
+		return nil
+	}
+
+	env := []string{
+		"NETNS_IP_ADDRESS=" + ep.IPAddress,
+		"NETNS_IP_PREFIX_LEN=" + strconv.Itoa(ep.IPPrefixLen),
+	}
+	if ep.Gateway != "" {
+		env = append(env, "NETNS_GATEWAY="+ep.Gateway)
+	}
+	if mac := macAddress(c); mac != "" {
+		env = append(env, "NETNS_MAC_ADDRESS="+mac)
+	}
+	// invalid bindings already failed the conversion of the container
+	if c.HostConfig != nil {
+		if published, err := portBindings(c.HostConfig.PortBindings); err == nil && len(published) > 0 {
+			env = append(env, "NETNS_PORT_BINDINGS="+strings.Join(published, ","))
+		}
+	}
+	return env
+}
+
+// macAddress returns the mac address of the container, the one it was
+// configured with or else the one the daemon assigned.
+func macAddress(c types.ContainerJSON) string {
+	if c.Config != nil && c.Config.MacAddress != "" {
+		return c.Config.MacAddress
+	}
+	return primaryEndpoint(c.NetworkSettings).MacAddress
+}
+
+// primaryEndpoint returns the addresses of the container from the default
+// network settings, or else from the first network with an address.
+func primaryEndpoint(ns *types.NetworkSettings) types.DefaultNetworkSettings {
+	if ns == nil {
+		return types.DefaultNetworkSettings{}
+	}
+	if ns.IPAddress != "" {
+		return ns.DefaultNetworkSettings
+	}
+
+	var names []string
+	for name, ep := range ns.Networks {
+		if ep != nil && ep.IPAddress != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return types.DefaultNetworkSettings{}
+	}
+	sort.Strings(names)
+	ep := ns.Networks[names[0]]
+	return types.DefaultNetworkSettings{
+		EndpointID:  ep.EndpointID,
+		Gateway:     ep.Gateway,
+		IPAddress:   ep.IPAddress,
+		IPPrefixLen: ep.IPPrefixLen,
+		IPv6Gateway: ep.IPv6Gateway,
+		MacAddress:  ep.MacAddress,
+	}
+}
+
+// exposedProtos are the protocols a port can be exposed with.
+var exposedProtos = map[string]bool{
+	"tcp":  true,
+	"udp":  true,
+	"sctp": true,
+}
+
+// parseExposedPorts records the ports the container exposes. The vendored nat
+// package only knows about tcp and udp, so the port/proto keys are split here.
+func parseExposedPorts(config *specs.Spec, ports map[nat.Port]struct{}) error {
+	var exposed []string
+	for p := range ports {
+		proto, port := nat.SplitProtoPort(string(p))
+		proto = strings.ToLower(proto)
+		if !exposedProtos[proto] {
+			return fmt.Errorf("exposed port %s has unknown protocol %q, try 'tcp', 'udp', or 'sctp'", p, proto)
+		}
+		if _, _, err := nat.ParsePortRangeToInt(port); err != nil {
+			return fmt.Errorf("parsing exposed port %s failed: %v", p, err)
+		}
+		exposed = append(exposed, port+"/"+proto)
+	}
+	if len(exposed) == 0 {
+		return nil
+	}
+
+	// sort the ports so the annotation is the same on every run
+	sort.Strings(exposed)
+	setAnnotation(config, AnnotationExposedPorts, strings.Join(exposed, ","))
+	return nil
+}
+
+// parsePortBindings records the ports the container publishes on the host.
+func parsePortBindings(config *specs.Spec, bindings nat.PortMap) error {
+	published, err := portBindings(bindings)
+	if err != nil {
+		return err
+	}
+	if len(published) > 0 {
+		setAnnotation(config, AnnotationPortBindings, strings.Join(published, ","))
+	}
+	return nil
+}
+
+// portBindings returns the port bindings in the -p syntax of docker, as
+// [hostIP:][hostPort:]containerPort/proto, sorted. Port ranges are expanded
+// into a binding per port. A range of host ports for a single container port
+// is kept as is, the daemon picks one port out of it.
+func portBindings(bindings nat.PortMap) ([]string, error) {
+	var published []string
+	for p, list := range bindings {
+		proto, port := nat.SplitProtoPort(string(p))
+		proto = strings.ToLower(proto)
+		if !exposedProtos[proto] {
+			return nil, fmt.Errorf("port binding %s has unknown protocol %q, try 'tcp', 'udp', or 'sctp'", p, proto)
+		}
+		start, end, err := nat.ParsePortRangeToInt(port)
+		if err != nil {
+			return nil, fmt.Errorf("parsing port binding %s failed: %v", p, err)
+		}
+
+		for _, b := range list {
+			host := ""
+			if b.HostIP != "" {
+				host = b.HostIP
+				if strings.Contains(host, ":") {
+					host = "[" + host + "]"
+				}
+				host += ":"
+			}
+
+			hostPorts := make([]string, end-start+1)
+			if b.HostPort != "" {
+				hostStart, hostEnd, err := nat.ParsePortRangeToInt(b.HostPort)
+				if err != nil {
+					return nil, fmt.Errorf("parsing the host port of port binding %s failed: %v", p, err)
+				}
+				switch {
+				case start == end:
+					hostPorts[0] = b.HostPort
+				case hostEnd-hostStart != end-start:
+					return nil, fmt.Errorf("port binding %s has host ports %s, the ranges have to be the same size", p, b.HostPort)
+				default:
+					for i := range hostPorts {
+						hostPorts[i] = strconv.Itoa(hostStart + i)
+					}
+				}
+			}
+
+			for i, hostPort := range hostPorts {
+				binding := host
+				if hostPort != "" || host != "" {
+					binding += hostPort + ":"
+				}
+				published = append(published, fmt.Sprintf("%s%d/%s", binding, start+i, proto))
+			}
+		}
+	}
+
+	// sort the bindings so the annotation is the same on every run
+	sort.Strings(published)
+	return published, nil
+}
+
+// Hosts returns the contents of a hosts file for the container, mapping its
+// address on each network to its hostname and aliases on that network.
+func Hosts(c types.ContainerJSON, hostname string) []byte {
+	if hostname == "" {
+		hostname = c.Config.Hostname
+	}
+
+	var b bytes.Buffer
+	b.WriteString("127.0.0.1\tlocalhost\n")
+	b.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+
+	if c.NetworkSettings != nil {
+		// sort the networks so the file is the same on every run
+		var names []string
+		for name := range c.NetworkSettings.Networks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			ep := c.NetworkSettings.Networks[name]
+			if ep == nil || ep.IPAddress == "" {
+				continue
+			}
+			fmt.Fprintf(&b, "%s\t%s\n", ep.IPAddress, strings.Join(append([]string{hostname}, ep.Aliases...), " "))
+		}
+	}
+
+	for _, h := range c.HostConfig.ExtraHosts {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) == 2 {
+			fmt.Fprintf(&b, "%s\t%s\n", parts[1], parts[0])
+		}
+	}
+
+	return b.Bytes()
+}
@@ -0,0 +1,172 @@
+package parse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/docker/engine-api/types"
+	"github.com/docker/engine-api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/opencontainers/specs/specs-go"
+)
+
+func TestNetworkAliases(t *testing.T) {
+	c := testContainer()
+	c.NetworkSettings = &types.NetworkSettings{
+		Networks: map[string]*network.EndpointSettings{
+			"backend": {
+				IPAddress: "172.18.0.2",
+				Aliases:   []string{"db", "postgres"},
+			},
+			"bridge": {
+				IPAddress: "172.17.0.2",
+			},
+		},
+	}
+
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aliases := config.Annotations[AnnotationNetworkAliases("backend")]; aliases != "db,postgres" {
+		t.Fatalf("expected backend aliases db,postgres, got %q", aliases)
+	}
+	if _, ok := config.Annotations[AnnotationNetworkAliases("bridge")]; ok {
+		t.Fatal("expected no aliases annotation for bridge")
+	}
+
+	hosts := string(Hosts(c, config.Hostname))
+	for _, line := range []string{"172.18.0.2\t4d2a3c1e8b7f db postgres\n", "172.17.0.2\t4d2a3c1e8b7f\n"} {
+		if !strings.Contains(hosts, line) {
+			t.Fatalf("expected hosts to contain %q, got:\n%s", line, hosts)
+		}
+	}
+}
+
+func TestExposedPorts(t *testing.T) {
+	c := testContainer()
+	c.Config.ExposedPorts = map[nat.Port]struct{}{
+		"80/tcp":         {},
+		"53/udp":         {},
+		"9/SCTP":         {},
+		"8000-8002/sctp": {},
+		"443":            {},
+	}
+
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "443/tcp,53/udp,80/tcp,8000-8002/sctp,9/sctp"
+	if ports := config.Annotations[AnnotationExposedPorts]; ports != expected {
+		t.Fatalf("expected exposed ports %q, got %q", expected, ports)
+	}
+
+	c.Config.ExposedPorts = map[nat.Port]struct{}{"80/dccp": {}}
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{}); err == nil {
+		t.Fatal("expected error for an unknown protocol")
+	}
+}
+
+func TestPortBindings(t *testing.T) {
+	c := testContainer()
+	c.HostConfig.PortBindings = nat.PortMap{
+		"8000-8002/tcp": {{HostIP: "127.0.0.1", HostPort: "9000-9002"}},
+		"53/udp":        {{HostIP: "::1", HostPort: "5353"}, {HostPort: "53"}},
+		"80/tcp":        {{HostPort: "8080-8090"}},
+		"7000-7001/tcp": {{}},
+	}
+
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "127.0.0.1:9000:8000/tcp,127.0.0.1:9001:8001/tcp,127.0.0.1:9002:8002/tcp,53:53/udp,7000/tcp,7001/tcp,8080-8090:80/tcp,[::1]:5353:53/udp"
+	if ports := config.Annotations[AnnotationPortBindings]; ports != expected {
+		t.Fatalf("expected port bindings %q, got %q", expected, ports)
+	}
+
+	c.NetworkSettings = &types.NetworkSettings{
+		DefaultNetworkSettings: types.DefaultNetworkSettings{IPAddress: "172.17.0.2", IPPrefixLen: 16},
+	}
+	hooks := specs.Hooks{Prestart: []specs.Hook{{Path: "netns"}}}
+	SetNetnsHookEnv(&hooks, c)
+	if env := hooks.Prestart[0].Env; env[len(env)-1] != "NETNS_PORT_BINDINGS="+expected {
+		t.Fatalf("expected the port bindings in the hook env, got %v", env)
+	}
+
+	c.HostConfig.PortBindings = nat.PortMap{"8000-8002/tcp": {{HostPort: "9000-9001"}}}
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{}); err == nil {
+		t.Fatal("expected error for port ranges of different sizes")
+	}
+}
+
+func TestSetNetnsHookEnv(t *testing.T) {
+	ns := &types.NetworkSettings{
+		Networks: map[string]*network.EndpointSettings{
+			"bridge": {
+				IPAddress:   "172.17.0.2",
+				IPPrefixLen: 16,
+				Gateway:     "172.17.0.1",
+			},
+		},
+	}
+	hooks := specs.Hooks{
+		Prestart: []specs.Hook{
+			{Path: "/usr/local/bin/netns"},
+			{Path: "/usr/bin/other"},
+		},
+	}
+	c := testContainer()
+	c.NetworkSettings = ns
+	SetNetnsHookEnv(&hooks, c)
+
+	expected := []string{
+		"NETNS_IP_ADDRESS=172.17.0.2",
+		"NETNS_IP_PREFIX_LEN=16",
+		"NETNS_GATEWAY=172.17.0.1",
+	}
+	if !reflect.DeepEqual(expected, hooks.Prestart[0].Env) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, hooks.Prestart[0].Env)
+	}
+	if hooks.Prestart[1].Env != nil {
+		t.Fatalf("expected no env for other hooks, got %v", hooks.Prestart[1].Env)
+	}
+}
+
+func TestMacAddressFallback(t *testing.T) {
+	c := testContainer()
+	c.NetworkSettings = &types.NetworkSettings{
+		Networks: map[string]*network.EndpointSettings{
+			"bridge": {
+				IPAddress:   "172.17.0.2",
+				IPPrefixLen: 16,
+				MacAddress:  "02:42:ac:11:00:02",
+			},
+		},
+	}
+
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mac := config.Annotations[AnnotationMacAddress]; mac != "02:42:ac:11:00:02" {
+		t.Fatalf("expected the assigned mac address, got %q", mac)
+	}
+	hooks := specs.Hooks{Prestart: []specs.Hook{{Path: "netns"}}}
+	SetNetnsHookEnv(&hooks, c)
+	if env := hooks.Prestart[0].Env; env[len(env)-1] != "NETNS_MAC_ADDRESS=02:42:ac:11:00:02" {
+		t.Fatalf("expected the assigned mac address in the hook env, got %v", env)
+	}
+
+	// the configured mac address wins
+	c.Config.MacAddress = "02:42:ac:11:00:99"
+	config, err = Config(c, "linux", "amd64", nil, 0, 0, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mac := config.Annotations[AnnotationMacAddress]; mac != "02:42:ac:11:00:99" {
+		t.Fatalf("expected the configured mac address, got %q", mac)
+	}
+}
@@ -3,8 +3,11 @@ package parse
 import (
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"strings"
 
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/engine-api/types"
 	containertypes "github.com/docker/engine-api/types/container"
 	"github.com/opencontainers/runc/libcontainer/configs"
 	"github.com/opencontainers/runc/libcontainer/devices"
@@ -99,7 +102,128 @@ func parseMappings(config *specs.Spec, hc *containertypes.HostConfig) error {
 	return nil
 }
 
-func parseSecurityOpt(config *specs.Spec, hc *containertypes.HostConfig) error {
+// processArgs returns the args of the process. The daemon already resolved
+// the entrypoint and cmd into the path and args, a shell form cmd is stored
+// as /bin/sh -c followed by the command, so it is used as is rather than
+// wrapped in another shell. Only if the path is missing are the entrypoint
+// and cmd joined, the same way the daemon does.
+func processArgs(c types.ContainerJSON) []string {
+	if c.Path != "" {
+		return append([]string{c.Path}, c.Args...)
+	}
+	if c.Config == nil {
+		return nil
+	}
+	args := append([]string{}, c.Config.Entrypoint...)
+	return append(args, c.Config.Cmd...)
+}
+
+// parseNanoCPUs sets the cfs quota and period for a --cpus limit. Docker does
+// not allow setting both, but if the inspect data has both the limit from
+// --cpus wins over the quota and period. Shares are a relative weight and are
+// kept either way.
+func parseNanoCPUs(config *specs.Spec, nanoCPUs int64) {
+	if nanoCPUs <= 0 {
+		return
+	}
+
+	cpu := config.Linux.Resources.CPU
+	if (cpu.Quota != nil && *cpu.Quota > 0) || (cpu.Period != nil && *cpu.Period > 0) {
+		logrus.Warnf("Both a cpu quota/period and a --cpus limit are set, using the --cpus limit")
+	}
+	cpu.Period = uint64ptr(DefaultCPUPeriod)
+	cpu.Quota = uint64ptr(nanoCPUs * DefaultCPUPeriod / 1e9)
+}
+
+// sysctlPrefixes are the top level directories of /proc/sys, a sysctl outside
+// of them does not exist and runc refuses it.
+var sysctlPrefixes = []string{"abi.", "debug.", "dev.", "fs.", "kernel.", "net.", "user.", "vm."}
+
+// parseSysctls sets the sysctls of the container, warning about the ones
+// that do not look like a sysctl so the failure is not a surprise at start.
+func parseSysctls(config *specs.Spec, sysctls map[string]string) {
+	for k, v := range sysctls {
+		known := false
+		for _, prefix := range sysctlPrefixes {
+			if strings.HasPrefix(k, prefix) {
+				known = true
+				break
+			}
+		}
+		if !known {
+			logrus.Warnf("Sysctl %s has an unknown prefix, the runtime may reject it", k)
+		}
+
+		if config.Linux.Sysctl == nil {
+			config.Linux.Sysctl = map[string]string{}
+		}
+		config.Linux.Sysctl[k] = v
+	}
+}
+
+// parseRestartPolicy records the restart policy of the container. The spec
+// has no notion of restarts, but tooling recreating the container needs to
+// tell always, which restarts a stopped container on daemon start, from
+// unless-stopped, which does not.
+func parseRestartPolicy(config *specs.Spec, rp containertypes.RestartPolicy) error {
+	switch {
+	case rp.Name == "", rp.IsNone():
+		setAnnotation(config, AnnotationRestartPolicy, "no")
+	case rp.IsAlways(), rp.IsUnlessStopped():
+		setAnnotation(config, AnnotationRestartPolicy, rp.Name)
+	case rp.IsOnFailure():
+		setAnnotation(config, AnnotationRestartPolicy, rp.Name)
+		if rp.MaximumRetryCount > 0 {
+			setAnnotation(config, AnnotationRestartMaxRetries, strconv.Itoa(rp.MaximumRetryCount))
+		}
+	default:
+		return fmt.Errorf("invalid restart policy %q", rp.Name)
+	}
+	return nil
+}
+
+// parseHealthcheck records the command of the healthcheck as an annotation.
+func parseHealthcheck(config *specs.Spec, hc *InspectHealthcheck) error {
+	if hc == nil {
+		return nil
+	}
+	cmd, err := healthcheckCommand(hc.Test)
+	if err != nil || cmd == nil {
+		return err
+	}
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return err
+	}
+	setAnnotation(config, AnnotationHealthcheck, string(data))
+	return nil
+}
+
+// healthcheckCommand returns the args to run for a healthcheck test, or nil
+// if there is no healthcheck to run.
+func healthcheckCommand(test []string) ([]string, error) {
+	if len(test) == 0 {
+		// inherited from the image, which the daemon already resolved
+		return nil, nil
+	}
+	switch test[0] {
+	case "NONE":
+		return nil, nil
+	case "CMD":
+		if len(test) < 2 {
+			return nil, fmt.Errorf("healthcheck %v has no command", test)
+		}
+		return test[1:], nil
+	case "CMD-SHELL":
+		if len(test) < 2 {
+			return nil, fmt.Errorf("healthcheck %v has no command", test)
+		}
+		return []string{"/bin/sh", "-c", strings.Join(test[1:], " ")}, nil
+	}
+	return nil, fmt.Errorf("unknown healthcheck type %q", test[0])
+}
+
+func parseSecurityOpt(config *specs.Spec, hc *containertypes.HostConfig, daemon *DaemonInfo) error {
 	var (
 		labelOpts []string
 		err       error
@@ -134,9 +258,13 @@ func parseSecurityOpt(config *specs.Spec, hc *containertypes.HostConfig) error {
 		}
 	}
 
-	// set default apparmor profile if possible
-	if config.Process.ApparmorProfile == "" && !hc.Privileged {
+	// set default apparmor profile if possible, the one of the daemon if it
+	// reports one other than the builtin default
+	if config.Process.ApparmorProfile == "" && !hc.Privileged && daemon.SecurityOption("apparmor") {
 		config.Process.ApparmorProfile = DefaultApparmorProfile
+		if profile := daemon.SecurityOptionProfile("apparmor"); profile != "" && profile != "default" {
+			config.Process.ApparmorProfile = profile
+		}
 	}
 	if config.Process.ApparmorProfile == "" && hc.Privileged {
 		config.Process.ApparmorProfile = "unconfined"
@@ -148,10 +276,19 @@ func parseSecurityOpt(config *specs.Spec, hc *containertypes.HostConfig) error {
 	}
 
 	// set default seccomp profile if the user did not pass a custom profile
-	if !customSeccompProfile && !hc.Privileged {
+	// and the daemon would have applied one
+	if !customSeccompProfile && !hc.Privileged && daemon.SecurityOption("seccomp") {
 		config.Linux.Seccomp = &defaultSeccompProfile
 	}
 
+	// only label the process if the daemon would have, docker ignores the
+	// label options without selinux
+	if !daemon.SecurityOption("selinux") {
+		if len(labelOpts) > 0 {
+			logrus.Warnf("Ignoring the label security options, the daemon does not have selinux enabled")
+		}
+		return nil
+	}
 	config.Process.SelinuxLabel, _, err = label.InitLabels(labelOpts)
 	return err
 }
@@ -1,10 +1,16 @@
 package parse
 
 import (
+	"bytes"
+	"os"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/engine-api/types"
 	containertypes "github.com/docker/engine-api/types/container"
+	"github.com/docker/engine-api/types/strslice"
 	"github.com/opencontainers/runc/libcontainer/user"
 	"github.com/opencontainers/specs/specs-go"
 )
@@ -115,3 +121,164 @@ func TestParseMappings(t *testing.T) {
 		}
 	}
 }
+
+type healthcheck struct {
+	test     []string
+	expected string
+}
+
+func TestParseHealthcheck(t *testing.T) {
+	tests := []healthcheck{
+		{
+			test:     []string{"CMD", "curl", "-f", "http://localhost/"},
+			expected: `["curl","-f","http://localhost/"]`,
+		},
+		{
+			test:     []string{"CMD-SHELL", "curl -f http://localhost/ || exit 1"},
+			expected: `["/bin/sh","-c","curl -f http://localhost/ || exit 1"]`,
+		},
+		{
+			test: []string{"NONE"},
+		},
+		{
+			test: []string{},
+		},
+	}
+
+	for _, test := range tests {
+		config := &specs.Spec{}
+		if err := parseHealthcheck(config, &InspectHealthcheck{Test: test.test}); err != nil {
+			t.Fatal(err)
+		}
+
+		got, ok := config.Annotations[AnnotationHealthcheck]
+		if test.expected == "" && ok {
+			t.Fatalf("expected no healthcheck annotation for %v, got %s", test.test, got)
+		}
+		if got != test.expected {
+			t.Fatalf("expected healthcheck annotation %s for %v, got %s", test.expected, test.test, got)
+		}
+	}
+
+	if err := parseHealthcheck(&specs.Spec{}, &InspectHealthcheck{Test: []string{"SHELL", "true"}}); err == nil {
+		t.Fatal("expected error for unknown healthcheck type")
+	}
+}
+
+type restartPolicy struct {
+	policy     containertypes.RestartPolicy
+	expected   string
+	maxRetries string
+}
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []restartPolicy{
+		{
+			policy:   containertypes.RestartPolicy{},
+			expected: "no",
+		},
+		{
+			policy:   containertypes.RestartPolicy{Name: "no"},
+			expected: "no",
+		},
+		{
+			policy:   containertypes.RestartPolicy{Name: "always"},
+			expected: "always",
+		},
+		{
+			policy:   containertypes.RestartPolicy{Name: "unless-stopped"},
+			expected: "unless-stopped",
+		},
+		{
+			policy:     containertypes.RestartPolicy{Name: "on-failure", MaximumRetryCount: 5},
+			expected:   "on-failure",
+			maxRetries: "5",
+		},
+	}
+
+	for _, test := range tests {
+		config := &specs.Spec{}
+		if err := parseRestartPolicy(config, test.policy); err != nil {
+			t.Fatal(err)
+		}
+		if got := config.Annotations[AnnotationRestartPolicy]; got != test.expected {
+			t.Fatalf("expected restart policy %s for %#v, got %s", test.expected, test.policy, got)
+		}
+		if got := config.Annotations[AnnotationRestartMaxRetries]; got != test.maxRetries {
+			t.Fatalf("expected max retries %q for %#v, got %q", test.maxRetries, test.policy, got)
+		}
+	}
+
+	if err := parseRestartPolicy(&specs.Spec{}, containertypes.RestartPolicy{Name: "sometimes"}); err == nil {
+		t.Fatal("expected error for invalid restart policy")
+	}
+}
+
+func TestParseSysctls(t *testing.T) {
+	var buf bytes.Buffer
+	logrus.SetOutput(&buf)
+	defer logrus.SetOutput(os.Stderr)
+
+	config := &specs.Spec{}
+	sysctls := map[string]string{
+		"net.ipv4.ip_forward": "1",
+		"kernel.shmmax":       "68719476736",
+		"ipv4.tcp_syncookies": "1",
+	}
+	parseSysctls(config, sysctls)
+
+	if !reflect.DeepEqual(sysctls, config.Linux.Sysctl) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", sysctls, config.Linux.Sysctl)
+	}
+	warnings := buf.String()
+	if !strings.Contains(warnings, "ipv4.tcp_syncookies") {
+		t.Fatalf("expected a warning for ipv4.tcp_syncookies, got:\n%s", warnings)
+	}
+	if strings.Contains(warnings, "net.ipv4.ip_forward") || strings.Contains(warnings, "kernel.shmmax") {
+		t.Fatalf("expected no warnings for known prefixes, got:\n%s", warnings)
+	}
+}
+
+type argsComposition struct {
+	path       string
+	args       []string
+	entrypoint strslice.StrSlice
+	cmd        strslice.StrSlice
+	expected   []string
+}
+
+func TestProcessArgs(t *testing.T) {
+	tests := []argsComposition{
+		// CMD echo hi
+		{
+			path:     "/bin/sh",
+			args:     []string{"-c", "echo hi"},
+			cmd:      strslice.StrSlice{"/bin/sh", "-c", "echo hi"},
+			expected: []string{"/bin/sh", "-c", "echo hi"},
+		},
+		// ENTRYPOINT ["nginx"] CMD ["-g", "daemon off;"]
+		{
+			path:       "nginx",
+			args:       []string{"-g", "daemon off;"},
+			entrypoint: strslice.StrSlice{"nginx"},
+			cmd:        strslice.StrSlice{"-g", "daemon off;"},
+			expected:   []string{"nginx", "-g", "daemon off;"},
+		},
+		// no path, shell form cmd from the image
+		{
+			cmd:      strslice.StrSlice{"/bin/sh", "-c", "echo hi"},
+			expected: []string{"/bin/sh", "-c", "echo hi"},
+		},
+	}
+
+	for _, test := range tests {
+		c := types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{Path: test.path, Args: test.args},
+			Config:            &containertypes.Config{Entrypoint: test.entrypoint, Cmd: test.cmd},
+		}
+		got := processArgs(c)
+		if !reflect.DeepEqual(test.expected, got) {
+			t.Fatalf("expected:\n%#v\ngot:\n%#v", test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package parse
+
+import (
+	"fmt"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/docker/go-units"
+	"github.com/opencontainers/specs/specs-go"
+)
+
+// ulimitTypes maps the ulimit names docker accepts to the resource limits of
+// the kernel.
+var ulimitTypes = map[string]string{
+	"as":         "RLIMIT_AS",
+	"core":       "RLIMIT_CORE",
+	"cpu":        "RLIMIT_CPU",
+	"data":       "RLIMIT_DATA",
+	"fsize":      "RLIMIT_FSIZE",
+	"locks":      "RLIMIT_LOCKS",
+	"memlock":    "RLIMIT_MEMLOCK",
+	"msgqueue":   "RLIMIT_MSGQUEUE",
+	"nice":       "RLIMIT_NICE",
+	"nofile":     "RLIMIT_NOFILE",
+	"nproc":      "RLIMIT_NPROC",
+	"rss":        "RLIMIT_RSS",
+	"rtprio":     "RLIMIT_RTPRIO",
+	"rttime":     "RLIMIT_RTTIME",
+	"sigpending": "RLIMIT_SIGPENDING",
+	"stack":      "RLIMIT_STACK",
+}
+
+// rlimitTypes are the resource limits of the kernel.
+var rlimitTypes = map[string]bool{}
+
+func init() {
+	for _, t := range ulimitTypes {
+		rlimitTypes[t] = true
+	}
+}
+
+// parseUlimits sets the rlimits of the process from the ulimits of the
+// container, which replace the default rlimit of the same type. A limit of
+// -1 is unlimited. A ulimit docker does not know is skipped with a warning,
+// or if validate is true is an error.
+func parseUlimits(config *specs.Spec, ulimits []*units.Ulimit, validate bool) error {
+	for _, ul := range ulimits {
+		t, ok := ulimitTypes[ul.Name]
+		if !ok {
+			if validate {
+				return fmt.Errorf("ulimit %s is not a resource limit docker knows", ul.Name)
+			}
+			logrus.Warnf("Skipping ulimit %s, it is not a resource limit docker knows", ul.Name)
+			continue
+		}
+		rl := specs.Rlimit{
+			Type: t,
+			Hard: uint64(ul.Hard),
+			Soft: uint64(ul.Soft),
+		}
+
+		replaced := false
+		for i, r := range config.Process.Rlimits {
+			if r.Type == rl.Type {
+				config.Process.Rlimits[i] = rl
+				replaced = true
+			}
+		}
+		if !replaced {
+			config.Process.Rlimits = append(config.Process.Rlimits, rl)
+		}
+	}
+	return nil
+}
+
+// ValidateRlimits returns an error for the rlimits of an unknown type or with
+// a soft limit above the hard limit, which the kernel would refuse to set.
+func ValidateRlimits(rlimits []specs.Rlimit) error {
+	for _, rl := range rlimits {
+		if !rlimitTypes[rl.Type] {
+			return fmt.Errorf("rlimit %s is not a known resource limit", rl.Type)
+		}
+		if rl.Soft > rl.Hard {
+			return fmt.Errorf("rlimit %s has a soft limit of %d above its hard limit of %d", rl.Type, rl.Soft, rl.Hard)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker/go-units"
+	"github.com/opencontainers/specs/specs-go"
+)
+
+func TestConfigUlimits(t *testing.T) {
+	c := testContainer()
+	c.HostConfig.Ulimits = []*units.Ulimit{
+		{Name: "nofile", Soft: 4096, Hard: 8192},
+		{Name: "nproc", Soft: -1, Hard: -1},
+	}
+
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []specs.Rlimit{
+		{Type: "RLIMIT_NOFILE", Soft: 4096, Hard: 8192},
+		{Type: "RLIMIT_NPROC", Soft: 18446744073709551615, Hard: 18446744073709551615},
+	}
+	if !reflect.DeepEqual(expected, config.Process.Rlimits) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, config.Process.Rlimits)
+	}
+	if err := ValidateRlimits(config.Process.Rlimits); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigUlimitAliases(t *testing.T) {
+	c := testContainer()
+	c.HostConfig.Ulimits = []*units.Ulimit{
+		{Name: "as", Soft: 1 << 30, Hard: 1 << 30},
+		{Name: "core", Soft: 0, Hard: -1},
+		{Name: "rss", Soft: 1 << 20, Hard: 1 << 21},
+		{Name: "sigpending", Soft: 64, Hard: 128},
+		{Name: "rtprio", Soft: 10, Hard: 20},
+		{Name: "handles", Soft: 1, Hard: 1},
+	}
+
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []specs.Rlimit{
+		{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 1024},
+		{Type: "RLIMIT_AS", Soft: 1 << 30, Hard: 1 << 30},
+		{Type: "RLIMIT_CORE", Soft: 0, Hard: 18446744073709551615},
+		{Type: "RLIMIT_RSS", Soft: 1 << 20, Hard: 1 << 21},
+		{Type: "RLIMIT_SIGPENDING", Soft: 64, Hard: 128},
+		{Type: "RLIMIT_RTPRIO", Soft: 10, Hard: 20},
+	}
+	if !reflect.DeepEqual(expected, config.Process.Rlimits) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, config.Process.Rlimits)
+	}
+}
+
+func TestConfigUlimitsValidate(t *testing.T) {
+	c := testContainer()
+	c.HostConfig.Ulimits = []*units.Ulimit{{Name: "handles", Soft: 1, Hard: 1}}
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{ValidateRlimits: true}); err == nil {
+		t.Fatal("expected error for a ulimit docker does not know")
+	}
+}
+
+func TestValidateRlimits(t *testing.T) {
+	for _, rlimits := range [][]specs.Rlimit{
+		{{Type: "RLIMIT_NOFILE", Soft: 8192, Hard: 4096}},
+		{{Type: "RLIMIT_NOFILE", Soft: 1024, Hard: 1024}, {Type: "RLIMIT_FILES", Soft: 1, Hard: 1}},
+	} {
+		if err := ValidateRlimits(rlimits); err == nil {
+			t.Fatalf("expected error for the rlimits %#v", rlimits)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package parse
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// syscallCapabilities maps syscalls to the capability they usually need.
+// Whether a syscall needs it depends on its arguments, bind only needs
+// NET_BIND_SERVICE for low ports for example, so this is a heuristic.
+var syscallCapabilities = map[string]string{
+	"acct":              "SYS_PACCT",
+	"adjtimex":          "SYS_TIME",
+	"bind":              "NET_BIND_SERVICE",
+	"bpf":               "SYS_ADMIN",
+	"capset":            "SETPCAP",
+	"chown":             "CHOWN",
+	"chroot":            "SYS_CHROOT",
+	"clock_adjtime":     "SYS_TIME",
+	"clock_settime":     "SYS_TIME",
+	"delete_module":     "SYS_MODULE",
+	"fanotify_init":     "SYS_ADMIN",
+	"fchown":            "CHOWN",
+	"fchownat":          "CHOWN",
+	"finit_module":      "SYS_MODULE",
+	"init_module":       "SYS_MODULE",
+	"ioperm":            "SYS_RAWIO",
+	"iopl":              "SYS_RAWIO",
+	"kexec_file_load":   "SYS_BOOT",
+	"kexec_load":        "SYS_BOOT",
+	"kill":              "KILL",
+	"lchown":            "CHOWN",
+	"lookup_dcookie":    "SYS_ADMIN",
+	"mknod":             "MKNOD",
+	"mknodat":           "MKNOD",
+	"mlock":             "IPC_LOCK",
+	"mlockall":          "IPC_LOCK",
+	"mount":             "SYS_ADMIN",
+	"open_by_handle_at": "DAC_READ_SEARCH",
+	"perf_event_open":   "SYS_ADMIN",
+	"pivot_root":        "SYS_ADMIN",
+	"process_vm_readv":  "SYS_PTRACE",
+	"process_vm_writev": "SYS_PTRACE",
+	"ptrace":            "SYS_PTRACE",
+	"quotactl":          "SYS_ADMIN",
+	"reboot":            "SYS_BOOT",
+	"sched_setaffinity": "SYS_NICE",
+	"sched_setparam":    "SYS_NICE",
+	"setdomainname":     "SYS_ADMIN",
+	"setfsgid":          "SETGID",
+	"setfsuid":          "SETUID",
+	"setgid":            "SETGID",
+	"setgroups":         "SETGID",
+	"sethostname":       "SYS_ADMIN",
+	"setns":             "SYS_ADMIN",
+	"setpriority":       "SYS_NICE",
+	"setregid":          "SETGID",
+	"setresgid":         "SETGID",
+	"setresuid":         "SETUID",
+	"setreuid":          "SETUID",
+	"setrlimit":         "SYS_RESOURCE",
+	"settimeofday":      "SYS_TIME",
+	"setuid":            "SETUID",
+	"stime":             "SYS_TIME",
+	"swapoff":           "SYS_ADMIN",
+	"swapon":            "SYS_ADMIN",
+	"syslog":            "SYSLOG",
+	"umount2":           "SYS_ADMIN",
+	"unshare":           "SYS_ADMIN",
+	"vhangup":           "SYS_TTY_CONFIG",
+}
+
+// SyscallCapabilities returns the sorted capabilities the syscalls usually
+// need, without the CAP_ prefix. Syscalls that need no capability are left out.
+func SyscallCapabilities(syscalls []string) []string {
+	seen := map[string]bool{}
+	caps := []string{}
+	for _, s := range syscalls {
+		c, ok := syscallCapabilities[strings.ToLower(s)]
+		if !ok || seen[c] {
+			continue
+		}
+		seen[c] = true
+		caps = append(caps, c)
+	}
+	sort.Strings(caps)
+	return caps
+}
+
+// AddSyscallCapabilities adds the capabilities the syscalls usually need to
+// caps, named in the given style, logging each one it adds.
+func AddSyscallCapabilities(caps, syscalls []string, style string) ([]string, error) {
+	return AddCapabilities(caps, SyscallCapabilities(syscalls), style, "the required syscalls usually need it")
+}
+
+// LoadSyscalls reads the syscalls from a file with one syscall per line,
+// blank lines and lines starting with # are skipped.
+func LoadSyscalls(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading syscalls %s failed: %v", path, err)
+	}
+	defer f.Close()
+
+	var syscalls []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		syscalls = append(syscalls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading syscalls %s failed: %v", path, err)
+	}
+	return syscalls, nil
+}
@@ -0,0 +1,46 @@
+package parse
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSyscallCapabilities(t *testing.T) {
+	expected := []string{"CHOWN", "NET_BIND_SERVICE", "SYS_ADMIN"}
+	got := SyscallCapabilities([]string{"mount", "read", "bind", "fchownat", "chown", "write"})
+	if !reflect.DeepEqual(expected, got) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, got)
+	}
+
+	caps, err := AddSyscallCapabilities([]string{"CAP_CHOWN"}, []string{"chown", "ptrace"}, CapabilityStylePrefixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []string{"CAP_CHOWN", "CAP_SYS_PTRACE"}
+	if !reflect.DeepEqual(expected, caps) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, caps)
+	}
+}
+
+func TestLoadSyscalls(t *testing.T) {
+	f, err := ioutil.TempFile("", "riddler-syscalls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("# needed by the init\nmount\n\n  sethostname \n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	syscalls, err := LoadSyscalls(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"mount", "sethostname"}
+	if !reflect.DeepEqual(expected, syscalls) {
+		t.Fatalf("expected:\n%#v\ngot:\n%#v", expected, syscalls)
+	}
+}
@@ -0,0 +1,113 @@
+package parse
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/opencontainers/runc/libcontainer/user"
+	"github.com/opencontainers/specs/specs-go"
+)
+
+// parseUser sets the process user from the user of the container, which is a
+// user name or uid optionally followed by :group, or only :group to keep the
+// default uid. Names are looked up in the passwd and group files under root,
+// the ones of the host if root is empty. If validate is true a name that is
+// not there is an error instead of a warning.
+func parseUser(config *specs.Spec, userSpec, root string, validate bool) error {
+	parts := strings.SplitN(userSpec, ":", 2)
+	if err := parseUID(config, parts[0], root, validate); err != nil {
+		return err
+	}
+	if len(parts) == 2 {
+		return parseGID(config, parts[1], root, validate)
+	}
+	return nil
+}
+
+// parseUID sets the uid and primary gid of the process from a user name or uid.
+func parseUID(config *specs.Spec, name, root string, validate bool) error {
+	if name == "" {
+		return nil
+	}
+
+	// uids do not need to be in the passwd file
+	if uid, err := strconv.ParseUint(name, 10, 32); err == nil {
+		config.Process.User.UID = uint32(uid)
+		return nil
+	}
+
+	u, err := lookupUser(root, name)
+	if err != nil {
+		if validate {
+			return fmt.Errorf("user %s does not exist in the passwd file: %v", name, err)
+		}
+		logrus.Warnf("Looking up user (%s) failed, running as root: %v", name, err)
+		return nil
+	}
+	config.Process.User.UID = uint32(u.Uid)
+	config.Process.User.GID = uint32(u.Gid)
+	return nil
+}
+
+// parseGID sets the gid of the process from a group name or gid, it takes
+// precedence over the primary group of the user.
+func parseGID(config *specs.Spec, name, root string, validate bool) error {
+	if name == "" {
+		return nil
+	}
+
+	if gid, err := strconv.ParseUint(name, 10, 32); err == nil {
+		config.Process.User.GID = uint32(gid)
+		return nil
+	}
+
+	g, err := lookupGroup(root, name)
+	if err != nil {
+		if validate {
+			return fmt.Errorf("group %s does not exist in the group file: %v", name, err)
+		}
+		logrus.Warnf("Looking up group (%s) failed, keeping gid %d: %v", name, config.Process.User.GID, err)
+		return nil
+	}
+	config.Process.User.GID = uint32(g.Gid)
+	return nil
+}
+
+// lookupUser looks up a user name in the passwd file under root, the one of
+// the host if root is empty.
+func lookupUser(root, name string) (user.User, error) {
+	if root == "" {
+		return user.LookupUser(name)
+	}
+	users, err := user.ParsePasswdFileFilter(filepath.Join(root, "etc", "passwd"), func(u user.User) bool {
+		return u.Name == name
+	})
+	if err != nil {
+		return user.User{}, err
+	}
+	if len(users) == 0 {
+		return user.User{}, fmt.Errorf("no matching entries in passwd file")
+	}
+	return users[0], nil
+}
+
+// lookupGroup looks up a group name in the group file under root, the one of
+// the host if root is empty.
+func lookupGroup(root, name string) (user.Group, error) {
+	if root == "" {
+		return user.LookupGroup(name)
+	}
+	groups, err := user.ParseGroupFileFilter(filepath.Join(root, "etc", "group"), func(g user.Group) bool {
+		return g.Name == name
+	})
+	if err != nil {
+		return user.Group{}, err
+	}
+	if len(groups) == 0 {
+		return user.Group{}, fmt.Errorf("no matching entries in group file")
+	}
+	return groups[0], nil
+}
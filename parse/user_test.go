@@ -0,0 +1,113 @@
+package parse
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigValidateUserExists(t *testing.T) {
+	c := testContainer()
+	c.Config.User = "riddler-no-such-user"
+
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{}); err != nil {
+		t.Fatalf("expected only a warning for an unknown user, got: %v", err)
+	}
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{ValidateUserExists: true}); err == nil {
+		t.Fatal("expected error for an unknown user")
+	}
+
+	c.Config.User = "root"
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{ValidateUserExists: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Process.User.UID != 0 {
+		t.Fatalf("expected uid 0 for root, got %d", config.Process.User.UID)
+	}
+
+	c.Config.User = "1000:1000"
+	config, err = Config(c, "linux", "amd64", nil, 0, 0, Options{ValidateUserExists: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Process.User.UID != 1000 {
+		t.Fatalf("expected uid 1000, got %d", config.Process.User.UID)
+	}
+}
+
+type groupOnlyUser struct {
+	user string
+	uid  uint32
+	gid  uint32
+}
+
+func TestConfigGroupOnlyUser(t *testing.T) {
+	tests := []groupOnlyUser{
+		{user: ":1000", uid: 0, gid: 1000},
+		{user: ":root", uid: 0, gid: 0},
+		{user: "1000:50", uid: 1000, gid: 50},
+	}
+
+	for _, test := range tests {
+		c := testContainer()
+		c.Config.User = test.user
+		config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{ValidateUserExists: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Process.User.UID != test.uid || config.Process.User.GID != test.gid {
+			t.Fatalf("expected uid %d and gid %d for %q, got uid %d and gid %d", test.uid, test.gid, test.user, config.Process.User.UID, config.Process.User.GID)
+		}
+	}
+
+	c := testContainer()
+	c.Config.User = ":riddler-no-such-group"
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{ValidateUserExists: true}); err == nil {
+		t.Fatal("expected error for an unknown group")
+	}
+}
+
+func TestConfigUserRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "riddler-root")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "etc", "passwd"), []byte("app:x:1500:1600::/home/app:/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "etc", "group"), []byte("staff:x:1700:app\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// validating only decides whether a name that is not there is an error
+	c := testContainer()
+	c.Config.User = "app:staff"
+	for _, validate := range []bool{false, true} {
+		config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{ValidateUserExists: validate, UserRoot: root})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Process.User.UID != 1500 || config.Process.User.GID != 1700 {
+			t.Fatalf("expected uid 1500 and gid 1700 from the container files with validate %v, got uid %d and gid %d", validate, config.Process.User.UID, config.Process.User.GID)
+		}
+	}
+
+	// the users of the host are not the users of the container
+	c.Config.User = "daemon"
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{UserRoot: root})
+	if err != nil {
+		t.Fatalf("expected only a warning for a user that is only in the host passwd file, got: %v", err)
+	}
+	if config.Process.User.UID != 0 {
+		t.Fatalf("expected uid 0 for a user that is only in the host passwd file, got %d", config.Process.User.UID)
+	}
+	if _, err := Config(c, "linux", "amd64", nil, 0, 0, Options{ValidateUserExists: true, UserRoot: root}); err == nil {
+		t.Fatal("expected error for a user that is only in the host passwd file")
+	}
+}
@@ -0,0 +1,93 @@
+package parse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/Sirupsen/logrus"
+)
+
+// SpecVersions are the spec versions riddler knows how to generate.
+var SpecVersions = []string{SpecVersion, "1.1.0"}
+
+// ResolveSpecVersion returns the spec version to generate for the requested
+// one, SpecVersion if it is empty. A version riddler does not know how to
+// generate falls back to SpecVersion with a warning, or if strict is true is
+// an error.
+func ResolveSpecVersion(version string, strict bool) (string, error) {
+	if version == "" {
+		return SpecVersion, nil
+	}
+	for _, v := range SpecVersions {
+		if v == version {
+			return v, nil
+		}
+	}
+	if strict {
+		return "", fmt.Errorf("unknown spec version %q, riddler generates %s", version, strings.Join(SpecVersions, ", "))
+	}
+	logrus.Warnf("Unknown spec version %q, generating %s instead", version, SpecVersion)
+	return SpecVersion, nil
+}
+
+// compareVersions compares two spec versions, like 1.0.0 and 1.0.0-rc3, and
+// returns -1, 0 or 1 if a is older, the same or newer than b. Pre-releases
+// are older than the release they precede, rc10 is newer than rc5.
+func compareVersions(a, b string) int {
+	va, pa := splitVersion(a)
+	vb, pb := splitVersion(b)
+	for i := 0; i < 3; i++ {
+		switch {
+		case va[i] < vb[i]:
+			return -1
+		case va[i] > vb[i]:
+			return 1
+		}
+	}
+	switch {
+	case pa == pb:
+		return 0
+	case pa == "":
+		return 1
+	case pb == "":
+		return -1
+	}
+	return comparePreReleases(pa, pb)
+}
+
+// comparePreReleases compares two pre-releases like rc5 and rc10 by their
+// number when they only differ there, as text otherwise.
+func comparePreReleases(a, b string) int {
+	na, nb := strings.TrimRight(a, "0123456789"), strings.TrimRight(b, "0123456789")
+	if na == nb {
+		ia, erra := strconv.Atoi(a[len(na):])
+		ib, errb := strconv.Atoi(b[len(nb):])
+		if erra == nil && errb == nil {
+			switch {
+			case ia < ib:
+				return -1
+			case ia > ib:
+				return 1
+			}
+			return 0
+		}
+	}
+	if a < b {
+		return -1
+	}
+	return 1
+}
+
+// splitVersion splits a version into its major, minor and patch numbers and
+// its pre-release.
+func splitVersion(v string) (numbers [3]int, pre string) {
+	parts := strings.SplitN(strings.TrimPrefix(v, "v"), "-", 2)
+	if len(parts) == 2 {
+		pre = parts[1]
+	}
+	for i, n := range strings.SplitN(parts[0], ".", 3) {
+		numbers[i], _ = strconv.Atoi(n)
+	}
+	return numbers, pre
+}
@@ -0,0 +1,47 @@
+package parse
+
+import "testing"
+
+func TestCompareVersions(t *testing.T) {
+	tests := [][3]string{
+		{"1.0.0-rc3", "1.0.0", "-1"},
+		{"1.0.0", "1.0.0-rc3", "1"},
+		{"1.0.0-rc3", "1.0.0-rc2", "1"},
+		{"1.0.0", "1.0.0", "0"},
+		{"1.0.2", "1.1.0", "-1"},
+		{"v1.1.0", "1.0.0", "1"},
+		{"1.0.0-rc10", "1.0.0-rc5", "1"},
+		{"1.0.0-rc5", "1.0.0-rc10", "-1"},
+		{"1.1.0-rc.1", "1.1.0-rc.2", "-1"},
+		{"1.0.0-beta", "1.0.0-rc1", "-1"},
+	}
+	for _, test := range tests {
+		got := compareVersions(test[0], test[1])
+		if expected := map[string]int{"-1": -1, "0": 0, "1": 1}[test[2]]; got != expected {
+			t.Fatalf("expected compareVersions(%s, %s) to be %d, got %d", test[0], test[1], expected, got)
+		}
+	}
+}
+
+func TestResolveSpecVersion(t *testing.T) {
+	for _, version := range []string{"", SpecVersion} {
+		got, err := ResolveSpecVersion(version, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != SpecVersion {
+			t.Fatalf("expected spec version %s for %q, got %s", SpecVersion, version, got)
+		}
+	}
+
+	got, err := ResolveSpecVersion("0.9.bogus", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != SpecVersion {
+		t.Fatalf("expected the fallback spec version %s, got %s", SpecVersion, got)
+	}
+	if _, err := ResolveSpecVersion("0.9.bogus", true); err == nil {
+		t.Fatal("expected error for a bogus spec version with strict")
+	}
+}
@@ -0,0 +1,94 @@
+package parse
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/docker/engine-api/types"
+	"github.com/opencontainers/specs/specs-go"
+)
+
+// WindowsSpec is the spec for a windows container. The vendored spec types
+// predate windows support, so it adds the fields windows uses to the output.
+type WindowsSpec struct {
+	*specs.Spec
+	Process WindowsProcess `json:"process"`
+}
+
+// WindowsProcess is the process of a windows container, windows takes the
+// whole command line as a single string instead of args.
+type WindowsProcess struct {
+	specs.Process
+	CommandLine string `json:"commandLine,omitempty"`
+}
+
+// IsWindows returns true if the container is a windows container.
+func IsWindows(config *specs.Spec, extra InspectExtra) bool {
+	if extra.Platform != "" {
+		return extra.Platform == "windows"
+	}
+	return config.Platform.OS == "windows"
+}
+
+// Windows converts the spec of a windows container into a WindowsSpec.
+func Windows(config *specs.Spec, c types.ContainerJSON) *WindowsSpec {
+	process := WindowsProcess{
+		Process: config.Process,
+	}
+
+	// args that are already escaped by the daemon are used as is
+	if c.Config.ArgsEscaped {
+		process.CommandLine = strings.Join(process.Args, " ")
+	} else {
+		args := make([]string, len(process.Args))
+		for i, arg := range process.Args {
+			args[i] = escapeArg(arg)
+		}
+		process.CommandLine = strings.Join(args, " ")
+	}
+	process.Args = nil
+
+	spec := *config
+	spec.Platform.OS = "windows"
+	return &WindowsSpec{
+		Spec:    &spec,
+		Process: process,
+	}
+}
+
+// escapeArg quotes an argument the way the windows command line parser
+// expects it, same as syscall.EscapeArg does on windows.
+func escapeArg(s string) string {
+	if s == "" {
+		return `""`
+	}
+	if !strings.ContainsAny(s, " \t\"\\") {
+		return s
+	}
+
+	hasSpace := strings.ContainsAny(s, " \t")
+	var b bytes.Buffer
+	if hasSpace {
+		b.WriteByte('"')
+	}
+	slashes := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			slashes++
+		case '"':
+			// escape the backslashes before the quote and the quote itself
+			b.WriteString(strings.Repeat(`\`, slashes+1))
+			slashes = 0
+		default:
+			slashes = 0
+		}
+		b.WriteByte(s[i])
+	}
+	if hasSpace {
+		// backslashes before the closing quote need escaping as well
+		b.WriteString(strings.Repeat(`\`, slashes))
+		b.WriteByte('"')
+	}
+	return b.String()
+}
@@ -0,0 +1,53 @@
+package parse
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWindowsCommandLine(t *testing.T) {
+	c := testContainer()
+	c.Path = `C:\Windows\System32\cmd.exe`
+	c.Args = []string{"/S", "/C", `echo "hello world"`}
+
+	extra, err := ParseInspectExtra([]byte(`{"Platform": "windows"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := Config(c, "linux", "amd64", nil, 0, 0, Options{Extra: extra})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsWindows(config, extra) {
+		t.Fatal("expected container to be detected as windows")
+	}
+
+	data, err := json.Marshal(Windows(config, c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out struct {
+		Platform struct {
+			OS string `json:"os"`
+		} `json:"platform"`
+		Process struct {
+			Args        []string `json:"args"`
+			CommandLine string   `json:"commandLine"`
+		} `json:"process"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `C:\Windows\System32\cmd.exe /S /C "echo \"hello world\""`
+	if out.Process.CommandLine != expected {
+		t.Fatalf("expected command line %s, got %s", expected, out.Process.CommandLine)
+	}
+	if out.Process.Args != nil {
+		t.Fatalf("expected no args, got %#v", out.Process.Args)
+	}
+	if out.Platform.OS != "windows" {
+		t.Fatalf("expected windows platform, got %s", out.Platform.OS)
+	}
+}